@@ -0,0 +1,76 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Append uploads the message msg, which must be a complete RFC 5322 message, to folder with the
+// given flags and internal date; the date is set by the server if it is zero. When the server
+// supports UIDPLUS the UID of the new message and the UIDVALIDITY of folder are returned, otherwise
+// they are zero
+func (d *Dialer) Append(folder string, flags []string, date time.Time, msg io.Reader) (uid int, uidValidity int, err error) {
+	return d.AppendContext(context.Background(), folder, flags, date, msg)
+}
+
+// AppendContext is Append with a context that can cancel the command or set its deadline
+func (d *Dialer) AppendContext(ctx context.Context, folder string, flags []string, date time.Time, msg io.Reader) (uid int, uidValidity int, err error) {
+	for _, f := range flags {
+		if !IsValidFlag(f) {
+			return 0, 0, fmt.Errorf("imap append: invalid flag %q", f)
+		}
+	}
+
+	var body bytes.Buffer
+	if _, err = io.Copy(&body, msg); err != nil {
+		return 0, 0, fmt.Errorf("imap append: %s", err)
+	}
+
+	command := strings.Builder{}
+	command.WriteString("APPEND ")
+	command.WriteString(d.mailbox(folder))
+	if len(flags) != 0 {
+		command.WriteString(" (" + strings.Join(flags, " ") + ")")
+	}
+	if !date.IsZero() {
+		command.WriteString(" " + quote(date.Format(TimeFormat)))
+	}
+
+	var continuation func(line []byte) ([]byte, error)
+	// LITERAL- (RFC 7888) only allows non-synchronizing literals up to 4096 bytes
+	if d.has(ctx, "LITERAL+") || (d.has(ctx, "LITERAL-") && body.Len() <= 4096) {
+		// Send the message straight away without waiting for the server
+		command.WriteString(fmt.Sprintf(" {%d+}%s", body.Len(), nl))
+		command.Write(body.Bytes())
+	} else {
+		command.WriteString(fmt.Sprintf(" {%d}", body.Len()))
+		sent := false
+		continuation = func(line []byte) ([]byte, error) {
+			if sent {
+				return nil, fmt.Errorf("imap append: unexpected continuation request")
+			}
+			sent = true
+			return append(body.Bytes(), nl...), nil
+		}
+	}
+
+	_, result, err := d.exec(ctx, command.String(), false, nil, continuation)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if code, args := responseCode(result); code == "APPENDUID" {
+		fields := strings.Fields(args)
+		if len(fields) == 2 {
+			uidValidity, _ = strconv.Atoi(fields[0])
+			uid, _ = strconv.Atoi(fields[1])
+		}
+	}
+
+	return uid, uidValidity, nil
+}
@@ -0,0 +1,372 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BodyPart is a part of a message's MIME tree as described by its BODYSTRUCTURE
+type BodyPart struct {
+	// Path is the part number used to fetch the part with FetchPart, e.g. "1.2". A multipart
+	// has the path of the message it is in, which is empty for the message itself
+	Path string
+	// Type and Subtype are the lower case MIME type, e.g. "text" and "plain"
+	Type    string
+	Subtype string
+	// Params are the Content-Type parameters by lower case name, e.g. charset
+	Params      map[string]string
+	ID          string
+	Description string
+	// Encoding is the lower case Content-Transfer-Encoding, e.g. base64
+	Encoding string
+	// Size is the size in bytes of the encoded part
+	Size int
+	// Lines is the number of lines of text and message/rfc822 parts
+	Lines int
+	// Disposition is the lower case Content-Disposition, e.g. attachment or inline
+	Disposition       string
+	DispositionParams map[string]string
+	// Filename is from the Content-Disposition filename or the Content-Type name, decoded
+	Filename string
+	// Parts are the parts of a multipart, or the body of a message/rfc822 part
+	Parts []*BodyPart
+}
+
+// MIMEType returns the type and subtype, e.g. "text/plain"
+func (p *BodyPart) MIMEType() string {
+	return p.Type + "/" + p.Subtype
+}
+
+// IsMultipart returns true if the part is a multipart, e.g. multipart/mixed
+func (p *BodyPart) IsMultipart() bool {
+	return p.Type == "multipart"
+}
+
+// Find returns the part with the path, or nil if there is none
+func (p *BodyPart) Find(path string) *BodyPart {
+	if p.Path == path && !p.IsMultipart() {
+		return p
+	}
+	for _, c := range p.Parts {
+		if f := c.Find(path); f != nil {
+			return f
+		}
+	}
+	if p.Path == path {
+		return p
+	}
+	return nil
+}
+
+// Attachments returns the parts below p which are attachments, those with an attachment
+// disposition or a filename, not including the parts of attached messages
+func (p *BodyPart) Attachments() []*BodyPart {
+	attachments := make([]*BodyPart, 0)
+	var walk func(p *BodyPart)
+	walk = func(p *BodyPart) {
+		if p.Disposition == "attachment" || (p.Filename != "" && !p.IsMultipart()) {
+			attachments = append(attachments, p)
+			return
+		}
+		for _, c := range p.Parts {
+			walk(c)
+		}
+	}
+	walk(p)
+	return attachments
+}
+
+// ParseBodyStructure parses a BODYSTRUCTURE (or BODY) fetch item, e.g. from FetchIter, into a MIME tree
+func ParseBodyStructure(token *Token) (*BodyPart, error) {
+	return parseBodyPart(token, "", true)
+}
+
+// parseBodyPart parses the body of the message with the path when messageBody is set,
+// otherwise the part of a multipart with the path
+func parseBodyPart(token *Token, path string, messageBody bool) (*BodyPart, error) {
+	if token == nil || token.Type != TContainer || len(token.Tokens) == 0 {
+		return nil, fmt.Errorf("imap: invalid BODYSTRUCTURE")
+	}
+	tks := token.Tokens
+
+	if tks[0].Type == TContainer {
+		// A multipart, its parts followed by the subtype and extension data
+		p := &BodyPart{Path: path, Type: "multipart"}
+		i := 0
+		for ; i < len(tks) && tks[i].Type == TContainer; i++ {
+			child, err := parseBodyPart(tks[i], joinPartPath(path, i+1), false)
+			if err != nil {
+				return nil, err
+			}
+			p.Parts = append(p.Parts, child)
+		}
+		if i < len(tks) {
+			p.Subtype = strings.ToLower(tokenString(tks[i]))
+		}
+		if i+1 < len(tks) {
+			p.Params = parseBodyParams(tks[i+1])
+		}
+		if i+2 < len(tks) {
+			p.Disposition, p.DispositionParams = parseDisposition(tks[i+2])
+		}
+		p.Filename = partFilename(p)
+		return p, nil
+	}
+
+	if len(tks) < 7 {
+		return nil, fmt.Errorf("imap: invalid BODYSTRUCTURE, too few fields")
+	}
+	if messageBody {
+		// The body of a message which isn't a multipart is its first part
+		path = joinPartPath(path, 1)
+	}
+	p := &BodyPart{
+		Path:        path,
+		Type:        strings.ToLower(tokenString(tks[0])),
+		Subtype:     strings.ToLower(tokenString(tks[1])),
+		Params:      parseBodyParams(tks[2]),
+		ID:          tokenString(tks[3]),
+		Description: tokenString(tks[4]),
+		Encoding:    strings.ToLower(tokenString(tks[5])),
+		Size:        tokenNumber(tks[6]),
+	}
+
+	// Extension data starts with the MD5, after any fields specific to the type
+	ext := 7
+	switch {
+	case p.Type == "text":
+		if len(tks) > 7 {
+			p.Lines = tokenNumber(tks[7])
+		}
+		ext = 8
+	case p.Type == "message" && (p.Subtype == "rfc822" || p.Subtype == "global") && len(tks) >= 10:
+		// The envelope, the body of the message and its lines
+		body, err := parseBodyPart(tks[8], p.Path, true)
+		if err != nil {
+			return nil, err
+		}
+		p.Parts = []*BodyPart{body}
+		p.Lines = tokenNumber(tks[9])
+		ext = 10
+	}
+	if ext+1 < len(tks) {
+		p.Disposition, p.DispositionParams = parseDisposition(tks[ext+1])
+	}
+	p.Filename = partFilename(p)
+
+	return p, nil
+}
+
+// joinPartPath returns the path of the nth part below the path
+func joinPartPath(path string, n int) string {
+	if path == "" {
+		return strconv.Itoa(n)
+	}
+	return path + "." + strconv.Itoa(n)
+}
+
+// tokenString returns the text of a string or atom token, or "" for NIL
+func tokenString(t *Token) string {
+	switch t.Type {
+	case TQuoted, TAtom, TLiteral:
+		return t.Str
+	case TNumber:
+		return strconv.Itoa(t.Num)
+	}
+	return ""
+}
+
+// tokenNumber returns the value of a number token, or 0
+func tokenNumber(t *Token) int {
+	if t.Type == TNumber {
+		return t.Num
+	}
+	return 0
+}
+
+// parseBodyParams parses a list of parameter names and values, decoding RFC 2231 parameters
+func parseBodyParams(t *Token) map[string]string {
+	params := make(map[string]string)
+	if t.Type != TContainer {
+		return params
+	}
+
+	raw := make(map[string]string)
+	names := make([]string, 0)
+	for i := 0; i+1 < len(t.Tokens); i += 2 {
+		name := strings.ToLower(tokenString(t.Tokens[i]))
+		raw[name] = tokenString(t.Tokens[i+1])
+		names = append(names, name)
+	}
+
+	// Let mime parse them as a Content-Type, which decodes RFC 2231 continuations and charsets
+	sort.Strings(names)
+	v := strings.Builder{}
+	v.WriteString("x/x")
+	for _, name := range names {
+		v.WriteString("; " + name + "=" + quote(raw[name]))
+	}
+	if _, decoded, err := mime.ParseMediaType(v.String()); err == nil {
+		raw = decoded
+	}
+
+	dec := mime.WordDecoder{CharsetReader: charsetReader}
+	for name, value := range raw {
+		if d, err := dec.DecodeHeader(value); err == nil {
+			value = d
+		}
+		params[name] = value
+	}
+	return params
+}
+
+// parseDisposition parses a body disposition, e.g. ("attachment" ("filename" "a.pdf"))
+func parseDisposition(t *Token) (disposition string, params map[string]string) {
+	if t.Type != TContainer || len(t.Tokens) == 0 {
+		return "", nil
+	}
+	disposition = strings.ToLower(tokenString(t.Tokens[0]))
+	if len(t.Tokens) > 1 {
+		params = parseBodyParams(t.Tokens[1])
+	}
+	return disposition, params
+}
+
+// partFilename returns the filename of the part from its disposition, or its name parameter
+func partFilename(p *BodyPart) string {
+	if f := p.DispositionParams["filename"]; f != "" {
+		return f
+	}
+	return p.Params["name"]
+}
+
+// GetBodyStructures returns the MIME tree of each message with the given UIDs in the current folder
+// by UID, which lists a message's parts and attachments without downloading them
+func (d *Dialer) GetBodyStructures(uids UIDSet) (structures map[int]*BodyPart, err error) {
+	return d.GetBodyStructuresContext(context.Background(), uids)
+}
+
+// GetBodyStructuresContext is GetBodyStructures with a context that can cancel the command or set its deadline
+func (d *Dialer) GetBodyStructuresContext(ctx context.Context, uids UIDSet) (structures map[int]*BodyPart, err error) {
+	if uids.Empty() {
+		return nil, fmt.Errorf("imap fetch: no UIDs given")
+	}
+
+	structures = make(map[int]*BodyPart)
+	processLine := func(line []byte) (err error) {
+		if !isFetchLine(line) {
+			return
+		}
+		m, err := d.parseFetchMessage(line)
+		if err != nil {
+			return err
+		}
+		if t, ok := m.Items["BODYSTRUCTURE"]; ok && m.UID != 0 {
+			if structures[m.UID], err = ParseBodyStructure(t); err != nil {
+				return fmt.Errorf("imap fetch: UID %d: %w", m.UID, err)
+			}
+		}
+		return
+	}
+	for _, set := range d.uidBatches(uids) {
+		if _, err = d.ExecContext(ctx, "UID FETCH "+set+" (UID BODYSTRUCTURE)", false, processLine); err != nil {
+			return nil, err
+		}
+	}
+
+	return structures, nil
+}
+
+// FetchPart downloads the part of the message with the UID in the current folder with the path,
+// e.g. "2" or "1.2" from BodyPart.Path, without the rest of the message. The part is returned with
+// its content decoded from its Content-Transfer-Encoding, text is left in the part's charset
+func (d *Dialer) FetchPart(uid int, partPath string) (part *BodyPart, content []byte, err error) {
+	return d.FetchPartContext(context.Background(), uid, partPath)
+}
+
+// FetchPartContext is FetchPart with a context that can cancel the command or set its deadline
+func (d *Dialer) FetchPartContext(ctx context.Context, uid int, partPath string) (part *BodyPart, content []byte, err error) {
+	if !validPartPath(partPath) {
+		return nil, nil, fmt.Errorf("imap fetch: invalid part path %q", partPath)
+	}
+
+	var raw *Token
+	var structure *BodyPart
+	section := "BODY[" + partPath + "]"
+	_, err = d.ExecContext(ctx, fmt.Sprintf("UID FETCH %d (UID BODYSTRUCTURE BODY.PEEK[%s])", uid, partPath), false, func(line []byte) (err error) {
+		if !isFetchLine(line) {
+			return
+		}
+		m, err := d.parseFetchMessage(line)
+		if err != nil || m.UID != uid {
+			return
+		}
+		if t, ok := m.Items["BODYSTRUCTURE"]; ok {
+			if structure, err = ParseBodyStructure(t); err != nil {
+				return
+			}
+		}
+		if t, ok := m.Items[section]; ok {
+			raw = t
+		}
+		return
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if structure == nil || raw == nil {
+		return nil, nil, ErrMessageNotFound
+	}
+
+	part = structure.Find(partPath)
+	if part == nil {
+		return nil, nil, fmt.Errorf("imap fetch: message has no part %s", partPath)
+	}
+
+	content, err = decodePart([]byte(tokenString(raw)), part.Encoding)
+	if err != nil {
+		return nil, nil, fmt.Errorf("imap fetch: part %s could not be decoded: %w", partPath, err)
+	}
+	return part, content, nil
+}
+
+// validPartPath returns true for a part path such as 1 or 1.2.3
+func validPartPath(path string) bool {
+	for _, n := range strings.Split(path, ".") {
+		if i, err := strconv.Atoi(n); err != nil || i < 1 || n[0] == '+' {
+			return false
+		}
+	}
+	return true
+}
+
+// decodePart decodes content from its Content-Transfer-Encoding
+func decodePart(content []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case "base64":
+		// Encoded lines are wrapped, which the decoder doesn't allow
+		content = bytes.Map(func(r rune) rune {
+			if r == '\r' || r == '\n' || r == ' ' || r == '\t' {
+				return -1
+			}
+			return r
+		}, content)
+		decoded := make([]byte, base64.StdEncoding.DecodedLen(len(content)))
+		n, err := base64.StdEncoding.Decode(decoded, content)
+		if err != nil {
+			return nil, err
+		}
+		return decoded[:n], nil
+	case "quoted-printable":
+		return io.ReadAll(quotedprintable.NewReader(bytes.NewReader(content)))
+	}
+	return content, nil
+}
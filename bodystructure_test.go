@@ -0,0 +1,215 @@
+package imap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// parseTestBodyStructure parses a BODYSTRUCTURE as it appears in a FETCH response
+func parseTestBodyStructure(t *testing.T, bodyStructure string) (*BodyPart, error) {
+	t.Helper()
+	m, err := (&Dialer{}).parseFetchMessage([]byte("* 1 FETCH (UID 1 BODYSTRUCTURE " + bodyStructure + ")\r\n"))
+	require.NoError(t, err)
+	return ParseBodyStructure(m.Items["BODYSTRUCTURE"])
+}
+
+// partPaths returns the path and MIME type of each part in the tree, depth first
+func partPaths(p *BodyPart) []string {
+	paths := []string{p.Path + " " + p.MIMEType()}
+	for _, c := range p.Parts {
+		paths = append(paths, partPaths(c)...)
+	}
+	return paths
+}
+
+func TestParseBodyStructureSinglePart(t *testing.T) {
+	p, err := parseTestBodyStructure(t, `("TEXT" "PLAIN" ("CHARSET" "US-ASCII") NIL NIL "7BIT" 3028 92)`)
+	require.NoError(t, err)
+	require.Equal(t, &BodyPart{
+		Path:     "1",
+		Type:     "text",
+		Subtype:  "plain",
+		Params:   map[string]string{"charset": "US-ASCII"},
+		Encoding: "7bit",
+		Size:     3028,
+		Lines:    92,
+	}, p)
+	require.Equal(t, "text/plain", p.MIMEType())
+	require.False(t, p.IsMultipart())
+	require.Same(t, p, p.Find("1"))
+	require.Empty(t, p.Attachments())
+}
+
+func TestParseBodyStructureMultipart(t *testing.T) {
+	// The example from RFC 3501 section 7.4.2
+	p, err := parseTestBodyStructure(t, `(("TEXT" "PLAIN" ("CHARSET" "US-ASCII") NIL NIL "7BIT" 1152 23)`+
+		`("TEXT" "PLAIN" ("CHARSET" "US-ASCII" "NAME" "cc.diff") "<960723163407.20117h@cac.washington.edu>" "Compiler diff" "BASE64" 4554 73) "MIXED")`)
+	require.NoError(t, err)
+	require.Equal(t, []string{" multipart/mixed", "1 text/plain", "2 text/plain"}, partPaths(p))
+	require.True(t, p.IsMultipart())
+
+	diff := p.Find("2")
+	require.NotNil(t, diff)
+	require.Equal(t, "<960723163407.20117h@cac.washington.edu>", diff.ID)
+	require.Equal(t, "Compiler diff", diff.Description)
+	require.Equal(t, "base64", diff.Encoding)
+	require.Equal(t, 4554, diff.Size)
+	require.Equal(t, 73, diff.Lines)
+	require.Equal(t, "cc.diff", diff.Filename)
+	require.Equal(t, []*BodyPart{diff}, p.Attachments())
+
+	require.Same(t, p, p.Find(""))
+	require.Nil(t, p.Find("3"))
+	require.Nil(t, p.Find("1.1"))
+}
+
+func TestParseBodyStructureNested(t *testing.T) {
+	p, err := parseTestBodyStructure(t, `(`+
+		// 1, an alternative with a plain and an HTML part with extension data
+		`(("text" "plain" ("charset" "utf-8") NIL NIL "quoted-printable" 100 5 NIL NIL NIL NIL)`+
+		`("text" "html" ("charset" "utf-8") NIL NIL "quoted-printable" 200 10 NIL NIL NIL NIL) "alternative" ("boundary" "b2") NIL NIL NIL)`+
+		// 2, an attachment
+		`("application" "pdf" ("name" "report.pdf") NIL NIL "base64" 3000 NIL ("attachment" ("filename" "report.pdf" "size" "2190")) NIL NIL)`+
+		// 3, an inline image
+		`("image" "png" NIL "<logo@example.com>" NIL "base64" 500 NIL ("inline" NIL) NIL NIL)`+
+		// 4, an attached message which is a multipart
+		`("message" "rfc822" NIL NIL NIL "7bit" 1000 `+
+		`("Mon, 1 Jan 2024 00:00:00 +0000" "Fwd" NIL NIL NIL NIL NIL NIL NIL "<fwd@example.com>") `+
+		`(("text" "plain" ("charset" "us-ascii") NIL NIL "7bit" 10 1)("application" "zip" NIL NIL NIL "base64" 20 NIL ("attachment" ("filename" "inner.zip")) NIL) "mixed") `+
+		`30 NIL ("attachment" ("filename" "fwd.eml")) NIL NIL)`+
+		// 5, an attached message which isn't a multipart
+		`("message" "rfc822" NIL NIL NIL "7bit" 500 `+
+		`("Mon, 1 Jan 2024 00:00:00 +0000" "Note" NIL NIL NIL NIL NIL NIL NIL "<note@example.com>") `+
+		`("text" "plain" ("charset" "us-ascii") NIL NIL "7bit" 10 1) 15)`+
+		` "mixed" ("boundary" "b1") NIL NIL NIL)`)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		" multipart/mixed",
+		"1 multipart/alternative",
+		"1.1 text/plain",
+		"1.2 text/html",
+		"2 application/pdf",
+		"3 image/png",
+		"4 message/rfc822",
+		"4 multipart/mixed",
+		"4.1 text/plain",
+		"4.2 application/zip",
+		"5 message/rfc822",
+		"5.1 text/plain",
+	}, partPaths(p))
+
+	require.Equal(t, "b1", p.Params["boundary"])
+	require.Equal(t, "b2", p.Find("1").Params["boundary"])
+	require.Equal(t, "quoted-printable", p.Find("1.2").Encoding)
+	require.Equal(t, 10, p.Find("1.2").Lines)
+
+	pdf := p.Find("2")
+	require.Equal(t, "attachment", pdf.Disposition)
+	require.Equal(t, map[string]string{"filename": "report.pdf", "size": "2190"}, pdf.DispositionParams)
+	require.Equal(t, "report.pdf", pdf.Filename)
+
+	logo := p.Find("3")
+	require.Equal(t, "inline", logo.Disposition)
+	require.Equal(t, "<logo@example.com>", logo.ID)
+	require.Equal(t, "", logo.Filename)
+
+	// Find returns the message/rfc822 part rather than the multipart with the same path
+	fwd := p.Find("4")
+	require.Equal(t, "message/rfc822", fwd.MIMEType())
+	require.Equal(t, 30, fwd.Lines)
+	require.Equal(t, "fwd.eml", fwd.Filename)
+	require.Equal(t, "application/zip", p.Find("4.2").MIMEType())
+	require.Equal(t, 15, p.Find("5").Lines)
+
+	// The parts of attached messages aren't attachments of the message
+	attachments := make([]string, 0)
+	for _, a := range p.Attachments() {
+		attachments = append(attachments, a.Path)
+	}
+	require.Equal(t, []string{"2", "4"}, attachments)
+	require.Equal(t, []*BodyPart{p.Find("4.2")}, fwd.Parts[0].Attachments())
+}
+
+func TestParseBodyStructureParams(t *testing.T) {
+	tests := []struct {
+		params, filename string
+	}{
+		{`("filename" "plain.txt")`, "plain.txt"},
+		// RFC 2231 charset and continuations
+		{`("filename*" "utf-8''caf%C3%A9.pdf")`, "café.pdf"},
+		{`("filename*0" "long " "filename*1" "name.txt")`, "long name.txt"},
+		{`("FILENAME*0*" "utf-8''caf%C3%A9" "FILENAME*1" " menu.pdf")`, "café menu.pdf"},
+		// RFC 2047 encoded words, which aren't standard in parameters but are common
+		{`("filename" "=?UTF-8?B?Y2Fmw6kucGRm?=")`, "café.pdf"},
+		{`("filename" "=?iso-8859-1?Q?caf=E9.pdf?=")`, "café.pdf"},
+		{`("filename" "=?unknown?Q?x.pdf?=")`, "=?unknown?Q?x.pdf?="},
+		{`("filename" "say \"hi\".txt")`, `say "hi".txt`},
+	}
+	for _, tt := range tests {
+		p, err := parseTestBodyStructure(t, `("application" "octet-stream" NIL NIL NIL "base64" 10 NIL ("attachment" `+tt.params+`) NIL NIL)`)
+		require.NoError(t, err, tt.params)
+		require.Equal(t, tt.filename, p.Filename, tt.params)
+	}
+
+	// The Content-Type name is used when there is no filename
+	p, err := parseTestBodyStructure(t, `("application" "octet-stream" ("name" "=?UTF-8?B?Y2Fmw6kucGRm?=") NIL NIL "base64" 10 NIL)`)
+	require.NoError(t, err)
+	require.Equal(t, "café.pdf", p.Filename)
+}
+
+func TestParseBodyStructureDeep(t *testing.T) {
+	// Multiparts nested more deeply than the tokenizer's initial stack
+	bs := `("text" "plain" NIL NIL NIL "7bit" 1 1)`
+	for i := 0; i < 10; i++ {
+		bs = "(" + bs + ` "mixed")`
+	}
+	p, err := parseTestBodyStructure(t, bs)
+	require.NoError(t, err)
+	require.Equal(t, "text/plain", p.Find(strings.TrimSuffix(strings.Repeat("1.", 10), ".")).MIMEType())
+}
+
+func TestParseBodyStructureInvalid(t *testing.T) {
+	for _, bs := range []string{
+		`NIL`,
+		`()`,
+		`("text" "plain" NIL NIL NIL "7bit")`,
+		`(("text" "plain" NIL) "mixed")`,
+	} {
+		_, err := parseTestBodyStructure(t, bs)
+		require.Error(t, err, bs)
+	}
+	_, err := ParseBodyStructure(nil)
+	require.Error(t, err)
+}
+
+func TestDecodePart(t *testing.T) {
+	tests := []struct {
+		content, encoding, decoded string
+	}{
+		{"hello", "7bit", "hello"},
+		{"hello", "", "hello"},
+		{"aGVs\r\nbG8=\r\n", "base64", "hello"},
+		{"caf=C3=A9 =\r\nmenu", "quoted-printable", "café menu"},
+	}
+	for _, tt := range tests {
+		decoded, err := decodePart([]byte(tt.content), tt.encoding)
+		require.NoError(t, err, tt.content)
+		require.Equal(t, tt.decoded, string(decoded), tt.content)
+	}
+
+	_, err := decodePart([]byte("not base64!"), "base64")
+	require.Error(t, err)
+}
+
+func TestValidPartPath(t *testing.T) {
+	for path, valid := range map[string]bool{
+		"1": true, "1.2": true, "10.2.3": true,
+		"": false, "0": false, "1.": false, ".1": false, "1..2": false, "+1": false, "-1": false,
+		"1.a": false, "HEADER": false, "1 2": false, "1.2]": false,
+	} {
+		require.Equal(t, valid, validPartPath(path), path)
+	}
+}
@@ -0,0 +1,89 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"strings"
+)
+
+// Capability issues the CAPABILITY command and returns the capabilities advertised by the server,
+// the result is cached and returned by Capabilities
+func (d *Dialer) Capability() (capabilities []string, err error) {
+	return d.CapabilityContext(context.Background())
+}
+
+// CapabilityContext is Capability with a context that can cancel the command or set its deadline
+func (d *Dialer) CapabilityContext(ctx context.Context) (capabilities []string, err error) {
+	d.capabilities = nil
+	if _, err = d.ExecContext(ctx, "CAPABILITY", false, nil); err != nil {
+		return nil, err
+	}
+	if d.capabilities == nil {
+		d.capabilities = make([]string, 0)
+	}
+
+	return d.Capabilities()
+}
+
+// Capabilities returns the capabilities advertised by the server. They are cached from the
+// server greeting and command responses, CAPABILITY is only issued when they are not known
+func (d *Dialer) Capabilities() (capabilities []string, err error) {
+	return d.CapabilitiesContext(context.Background())
+}
+
+// CapabilitiesContext is Capabilities with a context that can cancel the command or set its deadline
+func (d *Dialer) CapabilitiesContext(ctx context.Context) (capabilities []string, err error) {
+	if d.capabilities == nil {
+		return d.CapabilityContext(ctx)
+	}
+	capabilities = make([]string, len(d.capabilities))
+	copy(capabilities, d.capabilities)
+	return capabilities, nil
+}
+
+// Has returns true if the server advertises the capability, e.g. Has("MOVE") or Has("AUTH=PLAIN").
+// False is returned if the capabilities are not known and could not be fetched
+func (d *Dialer) Has(capability string) bool {
+	return d.has(context.Background(), capability)
+}
+
+func (d *Dialer) has(ctx context.Context, capability string) bool {
+	capabilities, err := d.CapabilitiesContext(ctx)
+	if err != nil {
+		return false
+	}
+	return hasCapability(capabilities, capability)
+}
+
+func hasCapability(capabilities []string, name string) bool {
+	for _, c := range capabilities {
+		if strings.EqualFold(c, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// updateCapabilities caches the capabilities from an untagged CAPABILITY response
+// or a CAPABILITY response code, such as in the greeting or the response to LOGIN
+func (d *Dialer) updateCapabilities(line []byte) {
+	parts := bytes.SplitN(dropNl(line), []byte(" "), 3)
+	if len(parts) != 3 {
+		return
+	}
+
+	var list []byte
+	switch {
+	case bytes.Equal(parts[0], []byte("*")) && bytes.Equal(parts[1], []byte("CAPABILITY")):
+		list = bytes.Join(parts[1:], []byte(" "))[len("CAPABILITY "):]
+	case (bytes.Equal(parts[1], []byte("OK")) || bytes.Equal(parts[1], []byte("PREAUTH"))) &&
+		bytes.HasPrefix(parts[2], []byte("[CAPABILITY ")):
+		list = parts[2][len("[CAPABILITY "):]
+		if end := bytes.IndexByte(list, ']'); end != -1 {
+			list = list[:end]
+		}
+	default:
+		return
+	}
+	d.capabilities = strings.Fields(string(list))
+}
@@ -0,0 +1,85 @@
+package imap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// commandBuilder builds a command containing strings which may have to be sent as literals
+type commandBuilder struct {
+	// segments are the parts of the command, each literal is sent between two segments
+	segments []string
+	literals []string
+	current  strings.Builder
+	// utf8 is set when a string containing non ASCII characters has been added
+	utf8 bool
+}
+
+// atom adds text to the command as it is
+func (b *commandBuilder) atom(s string) {
+	b.current.WriteString(s)
+}
+
+// str adds a string to the command, quoted when possible or as a literal
+// when it contains non ASCII characters or line breaks
+func (b *commandBuilder) str(s string) {
+	literal := false
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			b.utf8 = true
+			literal = true
+		} else if s[i] == '\r' || s[i] == '\n' || s[i] == 0 {
+			literal = true
+		}
+	}
+	if !literal {
+		b.current.WriteString(quote(s))
+		return
+	}
+	b.segments = append(b.segments, b.current.String())
+	b.literals = append(b.literals, s)
+	b.current.Reset()
+}
+
+func (b *commandBuilder) String() string {
+	s := strings.Builder{}
+	for i, l := range b.literals {
+		s.WriteString(fmt.Sprintf("%s{%d}%s%s", b.segments[i], len(l), nl, l))
+	}
+	s.WriteString(b.current.String())
+	return s.String()
+}
+
+// execBuilt executes a command built by a commandBuilder, sending its literals as
+// non-synchronizing literals when the server supports LITERAL+ and otherwise waiting
+// for the server to ask for each one
+func (d *Dialer) execBuilt(ctx context.Context, b *commandBuilder, buildResponse bool, processLine func(line []byte) error) (response string, result string, err error) {
+	if len(b.literals) == 0 {
+		return d.exec(ctx, b.current.String(), buildResponse, processLine, nil)
+	}
+
+	if d.has(ctx, "LITERAL+") {
+		command := strings.Builder{}
+		for i, l := range b.literals {
+			command.WriteString(fmt.Sprintf("%s{%d+}%s%s", b.segments[i], len(l), nl, l))
+		}
+		command.WriteString(b.current.String())
+		return d.exec(ctx, command.String(), buildResponse, processLine, nil)
+	}
+
+	next := 0
+	return d.exec(ctx, fmt.Sprintf("%s{%d}", b.segments[0], len(b.literals[0])), buildResponse, processLine, func(line []byte) ([]byte, error) {
+		if next >= len(b.literals) {
+			return nil, fmt.Errorf("imap: unexpected continuation request")
+		}
+		s := b.literals[next]
+		next++
+		if next < len(b.literals) {
+			s += fmt.Sprintf("%s{%d}", b.segments[next], len(b.literals[next]))
+		} else {
+			s += b.current.String()
+		}
+		return []byte(s + nl), nil
+	})
+}
@@ -0,0 +1,296 @@
+package imap
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Conversation is an email in a conversation built by ThreadEmails and its replies
+type Conversation struct {
+	// Email is nil when the message is missing but is known to be the parent of its children,
+	// or when it groups messages with the same subject
+	Email    *Email
+	Children []*Conversation
+
+	parent *Conversation
+}
+
+// messageIDPattern matches a message ID such as <1234@example.com>
+var messageIDPattern = regexp.MustCompile(`<[^<>\s]+>`)
+
+// subjectPrefix matches a reply or forward prefix such as "Re: ", "Fwd: " or "Re[2]: ", or a mailing list tag
+var subjectPrefix = regexp.MustCompile(`(?i)^\s*(?:((?:re|fwd?|aw|sv|antw)(?:\[\d+\])?)\s*:|\[[^\]]*\])\s*`)
+
+// parseMessageIDs returns the message IDs in a header such as References
+func parseMessageIDs(header string) []string {
+	return messageIDPattern.FindAllString(header, -1)
+}
+
+// baseSubject returns the subject without any reply or forward prefixes and mailing list tags,
+// and whether it had a reply or forward prefix
+func baseSubject(subject string) (base string, reply bool) {
+	for {
+		m := subjectPrefix.FindStringSubmatchIndex(subject)
+		if m == nil {
+			break
+		}
+		if m[2] != -1 {
+			reply = true
+		}
+		subject = subject[m[1]:]
+	}
+	return strings.ToLower(strings.TrimSpace(subject)), reply
+}
+
+// ThreadEmails groups emails, e.g. from GetOverviews or GetEmails, into conversations using the
+// JWZ algorithm (https://www.jwz.org/doc/threading.html) on their MessageID, InReplyTo and References,
+// which are only set by GetEmails. Messages which aren't linked by their headers are grouped by subject.
+// Conversations and their replies are ordered by date sent
+func ThreadEmails(emails []*Email) []*Conversation {
+	ids := make(map[string]*Conversation)
+	// order keeps the containers in the order they were created, so the result doesn't depend
+	// on the order of the map
+	order := make([]*Conversation, 0)
+	container := func(id string) *Conversation {
+		c, ok := ids[id]
+		if !ok {
+			c = &Conversation{}
+			ids[id] = c
+			order = append(order, c)
+		}
+		return c
+	}
+
+	for _, e := range emails {
+		if e == nil {
+			continue
+		}
+
+		var c *Conversation
+		if id := messageID(e.MessageID); id != "" && ids[id] != nil && ids[id].Email == nil {
+			c = ids[id]
+		} else if id != "" && ids[id] == nil {
+			c = container(id)
+		} else {
+			// Messages without an ID or with a duplicate ID are threaded on their own
+			c = &Conversation{}
+			order = append(order, c)
+		}
+		c.Email = e
+
+		references := make([]string, 0, len(e.References)+1)
+		for _, r := range e.References {
+			references = append(references, strings.ToLower(r))
+		}
+		if inReplyTo := parseMessageIDs(e.InReplyTo); len(inReplyTo) != 0 {
+			if r := strings.ToLower(inReplyTo[0]); len(references) == 0 || references[len(references)-1] != r {
+				references = append(references, r)
+			}
+		}
+
+		// Link the references together, keeping any links already made
+		var parent *Conversation
+		for _, r := range references {
+			ref := container(r)
+			if parent != nil && ref.parent == nil && ref != parent && !ref.isAncestorOf(parent) {
+				parent.addChild(ref)
+			}
+			parent = ref
+		}
+
+		// The message's own parent is always its last reference
+		if parent != nil && (parent == c || c.isAncestorOf(parent)) {
+			parent = nil
+		}
+		if c.parent != nil {
+			c.parent.removeChild(c)
+		}
+		if parent != nil {
+			parent.addChild(c)
+		}
+	}
+
+	root := &Conversation{}
+	for _, c := range order {
+		if c.parent == nil {
+			root.addChild(c)
+		}
+	}
+
+	root.pruneEmpty()
+	root.groupBySubject()
+	root.sortByDate()
+
+	for _, c := range root.Children {
+		c.parent = nil
+	}
+	return root.Children
+}
+
+// messageID returns the first message ID in s, lower cased
+func messageID(s string) string {
+	if ids := parseMessageIDs(s); len(ids) != 0 {
+		return strings.ToLower(ids[0])
+	}
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+func (c *Conversation) addChild(child *Conversation) {
+	child.parent = c
+	c.Children = append(c.Children, child)
+}
+
+func (c *Conversation) removeChild(child *Conversation) {
+	for i, ch := range c.Children {
+		if ch == child {
+			c.Children = append(c.Children[:i], c.Children[i+1:]...)
+			break
+		}
+	}
+	child.parent = nil
+}
+
+// isAncestorOf returns true if other is below c
+func (c *Conversation) isAncestorOf(other *Conversation) bool {
+	for p := other.parent; p != nil; p = p.parent {
+		if p == c {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneEmpty removes empty containers below c, moving their children up a level. At the top level
+// an empty container is kept if it has more than one child, so the children stay together
+func (c *Conversation) pruneEmpty() {
+	children := make([]*Conversation, 0, len(c.Children))
+	for _, ch := range c.Children {
+		ch.pruneEmpty()
+		if ch.Email != nil {
+			children = append(children, ch)
+			continue
+		}
+		if len(ch.Children) == 0 {
+			continue
+		}
+		if c.parent == nil && c.Email == nil && len(ch.Children) > 1 {
+			// c is the root, keep the empty container
+			children = append(children, ch)
+			continue
+		}
+		for _, gc := range ch.Children {
+			gc.parent = c
+			children = append(children, gc)
+		}
+	}
+	c.Children = children
+}
+
+// subject returns the subject of the container's message, or of its first child's if it is empty
+func (c *Conversation) subject() string {
+	if c.Email != nil {
+		return c.Email.Subject
+	}
+	if len(c.Children) != 0 && c.Children[0].Email != nil {
+		return c.Children[0].Email.Subject
+	}
+	return ""
+}
+
+// isReply returns true if the container has a message whose subject has a reply prefix
+func (c *Conversation) isReply() bool {
+	if c.Email == nil {
+		return false
+	}
+	_, reply := baseSubject(c.Email.Subject)
+	return reply
+}
+
+// groupBySubject merges the top level conversations below c which have the same base subject
+func (c *Conversation) groupBySubject() {
+	subjects := make(map[string]*Conversation)
+	for _, ch := range c.Children {
+		subject, _ := baseSubject(ch.subject())
+		if subject == "" {
+			continue
+		}
+		existing, ok := subjects[subject]
+		if !ok ||
+			(ch.Email == nil && existing.Email != nil) ||
+			(existing.isReply() && ch.Email != nil && !ch.isReply()) {
+			subjects[subject] = ch
+		}
+	}
+
+	children := make([]*Conversation, 0, len(c.Children))
+	for _, ch := range c.Children {
+		subject, _ := baseSubject(ch.subject())
+		other := subjects[subject]
+		if subject == "" || other == nil || other == ch {
+			children = append(children, ch)
+			continue
+		}
+
+		switch {
+		case other.Email == nil && ch.Email == nil:
+			for _, gc := range ch.Children {
+				other.addChild(gc)
+			}
+		case other.Email == nil:
+			// An empty container is always chosen for the subject when there is one
+			other.addChild(ch)
+		case ch.isReply() && !other.isReply():
+			other.addChild(ch)
+		default:
+			// Neither is a reply to the other, group them as siblings
+			group := &Conversation{parent: c}
+			for i, existing := range children {
+				if existing == other {
+					children[i] = group
+				}
+			}
+			c.replaceChild(other, group)
+			other.parent = nil
+			group.addChild(other)
+			group.addChild(ch)
+			subjects[subject] = group
+		}
+	}
+	c.Children = children
+}
+
+// replaceChild replaces old with new in c's children if it has already been seen
+func (c *Conversation) replaceChild(old *Conversation, new *Conversation) {
+	for i, ch := range c.Children {
+		if ch == old {
+			c.Children[i] = new
+		}
+	}
+}
+
+// date returns the date the container's message was sent, or its earliest child's if it is empty
+func (c *Conversation) date() (date int64) {
+	if c.Email != nil {
+		if !c.Email.Sent.IsZero() {
+			return c.Email.Sent.Unix()
+		}
+		return c.Email.Received.Unix()
+	}
+	for i, ch := range c.Children {
+		if d := ch.date(); i == 0 || d < date {
+			date = d
+		}
+	}
+	return date
+}
+
+// sortByDate orders the replies below c by the date they were sent
+func (c *Conversation) sortByDate() {
+	for _, ch := range c.Children {
+		ch.sortByDate()
+	}
+	sort.SliceStable(c.Children, func(i, j int) bool {
+		return c.Children[i].date() < c.Children[j].date()
+	})
+}
@@ -0,0 +1,226 @@
+package imap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testEmail returns an email with the UID and the message ID <uid@example.com>,
+// sent uid minutes after a fixed time
+func testEmail(uid int, subject string, inReplyTo string, references ...string) *Email {
+	return &Email{
+		UID:        uid,
+		MessageID:  fmt.Sprintf("<%d@example.com>", uid),
+		Subject:    subject,
+		InReplyTo:  inReplyTo,
+		References: references,
+		Sent:       time.Date(2024, 1, 1, 0, uid, 0, 0, time.UTC),
+	}
+}
+
+// conversationString formats conversations as the UID of each message, or - for an empty
+// container, followed by its replies in brackets, e.g. 1(2(3) 4)
+func conversationString(conversations []*Conversation) string {
+	s := make([]string, len(conversations))
+	for i, c := range conversations {
+		s[i] = "-"
+		if c.Email != nil {
+			s[i] = strconv.Itoa(c.Email.UID)
+		}
+		if len(c.Children) != 0 {
+			s[i] += "(" + conversationString(c.Children) + ")"
+		}
+	}
+	return strings.Join(s, " ")
+}
+
+func TestThreadEmails(t *testing.T) {
+	tests := []struct {
+		name          string
+		emails        []*Email
+		conversations string
+	}{
+		{"none", nil, ""},
+		{"nil emails", []*Email{nil, testEmail(1, "a", ""), nil}, "1"},
+		{"unrelated", []*Email{testEmail(1, "a", ""), testEmail(2, "b", "")}, "1 2"},
+		{
+			"references",
+			[]*Email{
+				testEmail(1, "a", ""),
+				testEmail(2, "b", "", "<1@example.com>"),
+				testEmail(3, "c", "", "<1@example.com>", "<2@example.com>"),
+				testEmail(4, "d", "", "<1@example.com>"),
+			},
+			"1(2(3) 4)",
+		},
+		{
+			"in reply to only",
+			[]*Email{
+				testEmail(1, "a", ""),
+				testEmail(2, "b", "<1@example.com>"),
+				testEmail(3, "c", "<2@example.com>"),
+			},
+			"1(2(3))",
+		},
+		{
+			"replies before their parent",
+			[]*Email{
+				testEmail(3, "c", "", "<1@example.com>", "<2@example.com>"),
+				testEmail(2, "b", "", "<1@example.com>"),
+				testEmail(1, "a", ""),
+			},
+			"1(2(3))",
+		},
+		{
+			"message IDs are case insensitive",
+			[]*Email{testEmail(1, "a", ""), testEmail(2, "b", "<1@EXAMPLE.COM>")},
+			"1(2)",
+		},
+		{
+			"missing parent of one reply",
+			[]*Email{testEmail(2, "b", "", "<missing@example.com>")},
+			"2",
+		},
+		{
+			"missing parent of several replies",
+			[]*Email{
+				testEmail(2, "b", "", "<missing@example.com>"),
+				testEmail(3, "c", "", "<missing@example.com>"),
+			},
+			"-(2 3)",
+		},
+		{
+			"missing message in a chain",
+			[]*Email{
+				testEmail(1, "a", ""),
+				testEmail(3, "c", "", "<1@example.com>", "<2@example.com>"),
+			},
+			"1(3)",
+		},
+		{
+			"reply by subject",
+			[]*Email{testEmail(2, "Re: Hello", ""), testEmail(1, "Hello", "")},
+			"1(2)",
+		},
+		{
+			"reply prefixes and list tags",
+			[]*Email{
+				testEmail(1, "[dev] Hello", ""),
+				testEmail(2, "RE: [dev] Hello", ""),
+				testEmail(3, "Fwd: Re[2]: Hello", ""),
+				testEmail(4, "AW: hello", ""),
+			},
+			"1(2 3 4)",
+		},
+		{
+			"same subject without a reply",
+			[]*Email{testEmail(1, "Hello", ""), testEmail(2, "hello", "")},
+			"-(1 2)",
+		},
+		{
+			"empty subjects aren't grouped",
+			[]*Email{testEmail(1, "", ""), testEmail(2, "Re:", "")},
+			"1 2",
+		},
+		{
+			"duplicate message IDs",
+			[]*Email{
+				testEmail(1, "a", ""),
+				{UID: 2, MessageID: "<1@example.com>", Subject: "b", Sent: time.Date(2024, 1, 1, 0, 2, 0, 0, time.UTC)},
+			},
+			"1 2",
+		},
+		{
+			"no message IDs",
+			[]*Email{
+				{UID: 1, Subject: "a", Sent: time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC)},
+				{UID: 2, Subject: "b", Sent: time.Date(2024, 1, 1, 0, 2, 0, 0, time.UTC)},
+			},
+			"1 2",
+		},
+		{
+			"reference loop",
+			[]*Email{
+				testEmail(1, "a", "", "<2@example.com>"),
+				testEmail(2, "b", "", "<1@example.com>"),
+			},
+			"2(1)",
+		},
+		{
+			"references itself",
+			[]*Email{testEmail(1, "a", "<1@example.com>", "<1@example.com>")},
+			"1",
+		},
+		{
+			"ordered by date sent",
+			[]*Email{
+				testEmail(5, "e", ""),
+				testEmail(1, "a", ""),
+				testEmail(4, "d", "<1@example.com>"),
+				testEmail(2, "b", "<1@example.com>"),
+				testEmail(3, "c", ""),
+			},
+			"1(2 4) 3 5",
+		},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.conversations, conversationString(ThreadEmails(tt.emails)), tt.name)
+
+		// The result doesn't depend on the order of the emails, except for which of them
+		// is threaded first when their headers conflict
+		reversed := make([]*Email, len(tt.emails))
+		for i, e := range tt.emails {
+			reversed[len(tt.emails)-1-i] = e
+		}
+		if tt.name != "reference loop" && tt.name != "duplicate message IDs" {
+			require.Equal(t, tt.conversations, conversationString(ThreadEmails(reversed)), tt.name+" reversed")
+		}
+	}
+}
+
+func TestThreadEmailsParents(t *testing.T) {
+	conversations := ThreadEmails([]*Email{testEmail(1, "a", ""), testEmail(2, "b", "<1@example.com>")})
+	require.Len(t, conversations, 1)
+	require.Nil(t, conversations[0].parent)
+	require.Same(t, conversations[0], conversations[0].Children[0].parent)
+}
+
+func TestBaseSubject(t *testing.T) {
+	tests := []struct {
+		subject, base string
+		reply         bool
+	}{
+		{"Hello", "hello", false},
+		{"  Hello  ", "hello", false},
+		{"Re: Hello", "hello", true},
+		{"re:Hello", "hello", true},
+		{"Re: Re: Hello", "hello", true},
+		{"Fw: Hello", "hello", true},
+		{"FWD: Hello", "hello", true},
+		{"Re[3]: Hello", "hello", true},
+		{"[list] Hello", "hello", false},
+		{"[list] Re: Hello", "hello", true},
+		{"Sv: Antw: Hello", "hello", true},
+		{"Reply: Hello", "reply: hello", false},
+		{"Hello Re: there", "hello re: there", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		base, reply := baseSubject(tt.subject)
+		require.Equal(t, tt.base, base, tt.subject)
+		require.Equal(t, tt.reply, reply, tt.subject)
+	}
+}
+
+func TestParseMessageIDs(t *testing.T) {
+	require.Equal(t, []string{"<a@b>", "<c@d>"}, parseMessageIDs("<a@b> <c@d>"))
+	require.Equal(t, []string{"<a@b>", "<c@d>"}, parseMessageIDs("<a@b>\r\n\t<c@d>"))
+	require.Equal(t, []string{"<c@d>"}, parseMessageIDs("(comment) <c@d>"))
+	require.Empty(t, parseMessageIDs(""))
+	require.Empty(t, parseMessageIDs("no ids here"))
+}
@@ -0,0 +1,181 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrMessageNotFound is the reason given for a requested UID that the server did not return,
+// usually because the message doesn't exist or has been expunged
+var ErrMessageNotFound = errors.New("imap: message not found")
+
+// SkippedEmail is a requested email which could not be returned and why
+type SkippedEmail struct {
+	UID int
+	Err error
+}
+
+func (s SkippedEmail) Error() string {
+	return fmt.Sprintf("UID %d: %s", s.UID, s.Err)
+}
+
+func (s SkippedEmail) Unwrap() error {
+	return s.Err
+}
+
+// GetEmailsOrdered is GetEmails returning the emails in the order of uids, e.g. the result of
+// SortUIDs, or in UID order if no UIDs are given. Emails which could not be returned are
+// reported in skipped with the reason, in the same order, rather than left out silently
+func (d *Dialer) GetEmailsOrdered(uids ...int) (emails []*Email, skipped []SkippedEmail, err error) {
+	return d.GetEmailsOrderedContext(context.Background(), uids...)
+}
+
+// GetEmailsOrderedContext is GetEmailsOrdered with a context that can cancel the command or set its deadline
+func (d *Dialer) GetEmailsOrderedContext(ctx context.Context, uids ...int) (emails []*Email, skipped []SkippedEmail, err error) {
+	set, none := requestedUIDs(uids)
+	if none {
+		emails, skipped = orderEmails(nil, uids, nil)
+		return emails, skipped, nil
+	}
+	found, reasons, err := d.getEmailsWithReasons(ctx, set)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	emails, skipped = orderEmails(found, uids, reasons)
+	return emails, skipped, nil
+}
+
+// GetEmailsOrderedSet is GetEmailsOrdered for the UIDs in the set, e.g. 500:*, returning the emails
+// in UID order. As a set's ranges may have gaps, only the emails the server returned which could
+// not be parsed are reported in skipped, not UIDs in the set without a message
+func (d *Dialer) GetEmailsOrderedSet(uids UIDSet) (emails []*Email, skipped []SkippedEmail, err error) {
+	return d.GetEmailsOrderedSetContext(context.Background(), uids)
+}
+
+// GetEmailsOrderedSetContext is GetEmailsOrderedSet with a context that can cancel the command or set its deadline
+func (d *Dialer) GetEmailsOrderedSetContext(ctx context.Context, uids UIDSet) (emails []*Email, skipped []SkippedEmail, err error) {
+	found, reasons, err := d.getEmailsWithReasons(ctx, uids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	emails, skipped = orderEmails(found, nil, reasons)
+	return emails, skipped, nil
+}
+
+// getEmailsWithReasons fetches emails with their bodies, returning why any emails were left out
+func (d *Dialer) getEmailsWithReasons(ctx context.Context, uids UIDSet) (found map[int]*Email, reasons map[int]error, err error) {
+	reasons = make(map[int]error)
+	found, err = d.getEmails(ctx, func(uid int, err error) {
+		reasons[uid] = fmt.Errorf("imap fetch: email body could not be parsed: %w", err)
+	}, uids)
+	return found, reasons, err
+}
+
+// GetOverviewsOrdered is GetOverviews returning the emails in the order of uids, e.g. the result of
+// SortUIDs, or in UID order if no UIDs are given. Emails which could not be returned are
+// reported in skipped with the reason, in the same order, rather than left out silently
+func (d *Dialer) GetOverviewsOrdered(uids ...int) (emails []*Email, skipped []SkippedEmail, err error) {
+	return d.GetOverviewsOrderedContext(context.Background(), uids...)
+}
+
+// GetOverviewsOrderedContext is GetOverviewsOrdered with a context that can cancel the command or set its deadline
+func (d *Dialer) GetOverviewsOrderedContext(ctx context.Context, uids ...int) (emails []*Email, skipped []SkippedEmail, err error) {
+	found, err := d.GetOverviewsContext(ctx, uids...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	emails, skipped = orderEmails(found, uids, nil)
+	return emails, skipped, nil
+}
+
+// GetOverviewsOrderedSet is GetOverviewsOrdered for the UIDs in the set, e.g. 500:*, returning
+// the emails in UID order. Skipped is always empty, UIDs in the set without a message aren't reported
+// as a set's ranges may have gaps
+func (d *Dialer) GetOverviewsOrderedSet(uids UIDSet) (emails []*Email, skipped []SkippedEmail, err error) {
+	return d.GetOverviewsOrderedSetContext(context.Background(), uids)
+}
+
+// GetOverviewsOrderedSetContext is GetOverviewsOrderedSet with a context that can cancel the command or set its deadline
+func (d *Dialer) GetOverviewsOrderedSetContext(ctx context.Context, uids UIDSet) (emails []*Email, skipped []SkippedEmail, err error) {
+	found, err := d.GetOverviewsSetContext(ctx, uids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	emails, skipped = orderEmails(found, nil, nil)
+	return emails, skipped, nil
+}
+
+// orderEmails returns the found emails in the order of uids, or in UID order if no UIDs are given,
+// and the UIDs which were not found with their reason, ErrMessageNotFound if there is none
+func orderEmails(found map[int]*Email, uids []int, reasons map[int]error) (emails []*Email, skipped []SkippedEmail) {
+	if len(uids) == 0 {
+		uids = make([]int, 0, len(found)+len(reasons))
+		for uid := range found {
+			uids = append(uids, uid)
+		}
+		for uid := range reasons {
+			if _, ok := found[uid]; !ok {
+				uids = append(uids, uid)
+			}
+		}
+		sort.Ints(uids)
+	}
+
+	emails = make([]*Email, 0, len(uids))
+	skipped = make([]SkippedEmail, 0)
+	seen := make(map[int]bool, len(uids))
+	for _, uid := range uids {
+		if seen[uid] {
+			continue
+		}
+		seen[uid] = true
+
+		if e, ok := found[uid]; ok {
+			emails = append(emails, e)
+			continue
+		}
+		reason := reasons[uid]
+		if reason == nil {
+			reason = ErrMessageNotFound
+		}
+		skipped = append(skipped, SkippedEmail{UID: uid, Err: reason})
+	}
+
+	return emails, skipped
+}
+
+// fetchBatches fetches the items for the UIDs, in batches of at most BatchSize UIDs or UID ranges,
+// returning the combined response
+func (d *Dialer) fetchBatches(ctx context.Context, uids UIDSet, items string) (response string, err error) {
+	if uids.Empty() {
+		return "", fmt.Errorf("imap fetch: no UIDs given")
+	}
+
+	r := strings.Builder{}
+	for _, set := range d.uidBatches(uids) {
+		resp, err := d.ExecContext(ctx, "UID FETCH "+set+" "+items, true, nil)
+		if err != nil {
+			return "", err
+		}
+		r.WriteString(resp)
+	}
+	return r.String(), nil
+}
+
+// requestedUIDs returns the UIDs as a set, or 1:* for every message if no UIDs are given.
+// None is set when UIDs were given but none of them are valid, so nothing is fetched
+func requestedUIDs(uids []int) (set UIDSet, none bool) {
+	if len(uids) == 0 {
+		set.AddRange(1, Star)
+		return set, false
+	}
+	set = NewUIDSet(uids...)
+	return set, set.Empty()
+}
@@ -0,0 +1,87 @@
+package imap
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fetchServer answers each command with the message with UID 501 for a FETCH of ALL or BODY[],
+// and OK for anything else, sending the commands it received on commands
+func fetchServer(server net.Conn, commands chan<- string) {
+	defer close(commands)
+	body := "Subject: Hello\r\nFrom: a@example.com\r\n\r\nHi\r\n"
+	r := bufio.NewReader(server)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		commands <- fields[1]
+		switch {
+		case strings.HasSuffix(fields[1], " ALL"):
+			fmt.Fprintf(server, "* 1 FETCH (UID 501 FLAGS (\\Seen) INTERNALDATE \"17-Jul-1996 02:44:25 -0700\" RFC822.SIZE %d ENVELOPE (\"Wed, 17 Jul 1996 02:23:25 -0700\" \"Hello\" ((NIL NIL \"a\" \"example.com\")) NIL NIL NIL NIL NIL NIL \"<1@example.com>\"))\r\n", len(body))
+		case strings.HasSuffix(fields[1], " BODY.PEEK[]"):
+			fmt.Fprintf(server, "* 1 FETCH (UID 501 BODY[] {%d}\r\n%s)\r\n", len(body), body)
+		}
+		fmt.Fprintf(server, "%s OK done\r\n", fields[0])
+	}
+}
+
+func TestGetEmailsSet(t *testing.T) {
+	d, server := newPipeDialer(t)
+	commands := make(chan string, 10)
+	go fetchServer(server, commands)
+
+	set, err := ParseUIDSet("500:*")
+	require.NoError(t, err)
+	emails, err := d.GetEmailsSet(set)
+	require.NoError(t, err)
+	require.Equal(t, "UID FETCH 500:* ALL", <-commands)
+	require.Equal(t, "UID FETCH 501 BODY.PEEK[]", <-commands)
+	require.Len(t, emails, 1)
+	require.Equal(t, "Hello", emails[501].Subject)
+	require.Equal(t, "Hi\r\n", emails[501].Text)
+
+	ordered, skipped, err := d.GetOverviewsOrderedSet(set)
+	require.NoError(t, err)
+	require.Equal(t, "UID FETCH 500:* ALL", <-commands)
+	require.Len(t, ordered, 1)
+	require.Empty(t, skipped)
+
+	// UIDs were given but none are valid, so nothing is fetched rather than every message
+	emails, err = d.GetEmails(0)
+	require.NoError(t, err)
+	require.Empty(t, emails)
+
+	// An empty set is an error rather than every message
+	empty := NewUIDSet(1, 2).Intersection(NewUIDSet(3))
+	_, err = d.GetEmailsSet(empty)
+	require.Error(t, err)
+	_, err = d.GetOverviewsSet(UIDSet{})
+	require.Error(t, err)
+	_, _, err = d.GetEmailsOrderedSet(empty)
+	require.Error(t, err)
+	it := d.FetchIter(empty, "FLAGS")
+	require.False(t, it.Next())
+	require.Error(t, it.Err())
+	require.Error(t, it.Close())
+
+	// Without UIDs every message is fetched
+	_, err = d.GetOverviews()
+	require.NoError(t, err)
+	require.Equal(t, "UID FETCH 1:* ALL", <-commands)
+
+	// A set which is empty, e.g. an empty Difference, doesn't expunge every message
+	require.Error(t, d.Expunge(NewUIDSet(0)))
+	require.Error(t, d.Expunge(NewUIDSet(1, 2).Difference(NewUIDSet(1, 2))))
+	require.NoError(t, d.Expunge(NewUIDSet(3, 1, 2)))
+	require.Equal(t, "UID EXPUNGE 1:3", <-commands)
+	require.NoError(t, d.ExpungeAll())
+	require.Equal(t, "EXPUNGE", <-commands)
+}
@@ -0,0 +1,160 @@
+package imap
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// System flags (RFC 3501 2.3.2), any other flag is a keyword such as $Forwarded
+const (
+	FlagSeen     = `\Seen`
+	FlagAnswered = `\Answered`
+	FlagFlagged  = `\Flagged`
+	FlagDeleted  = `\Deleted`
+	FlagDraft    = `\Draft`
+)
+
+// FlagOp is how StoreFlags changes the flags of messages
+type FlagOp uint8
+
+const (
+	// FlagsAdd adds the flags to those already set (+FLAGS)
+	FlagsAdd FlagOp = iota
+	// FlagsRemove removes the flags (-FLAGS)
+	FlagsRemove
+	// FlagsSet replaces all the flags (FLAGS)
+	FlagsSet
+)
+
+func (op FlagOp) String() string {
+	switch op {
+	case FlagsAdd:
+		return "+FLAGS"
+	case FlagsRemove:
+		return "-FLAGS"
+	case FlagsSet:
+		return "FLAGS"
+	}
+	return ""
+}
+
+// AddFlags adds the flags to the messages with the given UIDs in the current folder,
+// returning the updated flags of each message by UID
+func (d *Dialer) AddFlags(uids UIDSet, flags ...string) (updated map[int][]string, err error) {
+	return d.StoreFlagsContext(context.Background(), uids, FlagsAdd, false, flags...)
+}
+
+// RemoveFlags removes the flags from the messages with the given UIDs in the current folder,
+// returning the updated flags of each message by UID
+func (d *Dialer) RemoveFlags(uids UIDSet, flags ...string) (updated map[int][]string, err error) {
+	return d.StoreFlagsContext(context.Background(), uids, FlagsRemove, false, flags...)
+}
+
+// SetFlags replaces the flags of the messages with the given UIDs in the current folder,
+// returning the updated flags of each message by UID
+func (d *Dialer) SetFlags(uids UIDSet, flags ...string) (updated map[int][]string, err error) {
+	return d.StoreFlagsContext(context.Background(), uids, FlagsSet, false, flags...)
+}
+
+// StoreFlags changes the flags of the messages with the given UIDs in the current folder
+// using UID STORE. Unless silent is set the updated flags of each message are returned by UID
+func (d *Dialer) StoreFlags(uids UIDSet, op FlagOp, silent bool, flags ...string) (updated map[int][]string, err error) {
+	return d.StoreFlagsContext(context.Background(), uids, op, silent, flags...)
+}
+
+// StoreFlagsContext is StoreFlags with a context that can cancel the command or set its deadline
+func (d *Dialer) StoreFlagsContext(ctx context.Context, uids UIDSet, op FlagOp, silent bool, flags ...string) (updated map[int][]string, err error) {
+	if uids.Empty() {
+		return nil, fmt.Errorf("imap store: no UIDs given")
+	}
+	for _, f := range flags {
+		if !IsValidFlag(f) {
+			return nil, fmt.Errorf("imap store: invalid flag %q", f)
+		}
+	}
+
+	item := op.String()
+	if silent {
+		item += ".SILENT"
+	}
+
+	updated = make(map[int][]string)
+	processLine := func(line []byte) (err error) {
+		if !isFetchLine(line) {
+			return
+		}
+		records, err := d.ParseFetchResponse(string(line))
+		if err != nil {
+			return
+		}
+		for _, tks := range records {
+			uid := 0
+			var flags []string
+			for i := 0; i+1 < len(tks); i++ {
+				switch tks[i].Str {
+				case "UID":
+					if err = d.CheckType(tks[i+1], []TType{TNumber}, tks, "after UID"); err != nil {
+						return
+					}
+					uid = tks[i+1].Num
+				case "FLAGS":
+					if err = d.CheckType(tks[i+1], []TType{TContainer}, tks, "after FLAGS"); err != nil {
+						return
+					}
+					flags = make([]string, len(tks[i+1].Tokens))
+					for i, t := range tks[i+1].Tokens {
+						flags[i] = t.Str
+					}
+				}
+			}
+			if uid != 0 && flags != nil {
+				updated[uid] = flags
+			}
+		}
+		return
+	}
+	for _, set := range d.uidBatches(uids) {
+		_, err = d.ExecContext(ctx, fmt.Sprintf("UID STORE %s %s (%s)", set, item, strings.Join(flags, " ")), false, processLine)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return updated, nil
+}
+
+// IsValidFlag returns true if f is a system flag or a keyword that can be stored on a message
+func IsValidFlag(f string) bool {
+	if len(f) == 0 {
+		return false
+	}
+	if f[0] == '\\' {
+		f = f[1:]
+		if len(f) == 0 {
+			return false
+		}
+	}
+	for _, r := range f {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune(`(){%*"\]`, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isFetchLine returns true if line is an untagged FETCH response
+func isFetchLine(line []byte) bool {
+	fields := strings.SplitN(string(line), " ", 4)
+	if len(fields) < 3 || fields[0] != "*" || !strings.EqualFold(fields[2], "FETCH") {
+		return false
+	}
+	_, err := strconv.Atoi(fields[1])
+	return err == nil
+}
+
+// joinUIDs returns the UIDs as a sequence set, compressed into ranges where possible
+func joinUIDs(uids []int) string {
+	return NewUIDSet(uids...).String()
+}
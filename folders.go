@@ -0,0 +1,390 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CreateFolder creates a folder, any missing parent folders in its path are normally
+// created by the server too
+func (d *Dialer) CreateFolder(folder string) (err error) {
+	return d.CreateFolderContext(context.Background(), folder)
+}
+
+// CreateFolderContext is CreateFolder with a context that can cancel the command or set its deadline
+func (d *Dialer) CreateFolderContext(ctx context.Context, folder string) (err error) {
+	_, err = d.ExecContext(ctx, "CREATE "+d.mailbox(folder), false, nil)
+	return
+}
+
+// DeleteFolder deletes a folder and the messages in it. Servers normally refuse to delete
+// a folder that has child folders, so these must be deleted first
+func (d *Dialer) DeleteFolder(folder string) (err error) {
+	return d.DeleteFolderContext(context.Background(), folder)
+}
+
+// DeleteFolderContext is DeleteFolder with a context that can cancel the command or set its deadline
+func (d *Dialer) DeleteFolderContext(ctx context.Context, folder string) (err error) {
+	_, err = d.ExecContext(ctx, "DELETE "+d.mailbox(folder), false, nil)
+	if err != nil {
+		return
+	}
+	if d.Folder == folder {
+		d.Folder = ""
+		d.selected = nil
+	}
+	return nil
+}
+
+// RenameFolder renames a folder, its child folders are renamed with it.
+// Renaming INBOX moves its messages to the new folder and leaves INBOX empty
+func (d *Dialer) RenameFolder(from string, to string) (err error) {
+	return d.RenameFolderContext(context.Background(), from, to)
+}
+
+// RenameFolderContext is RenameFolder with a context that can cancel the command or set its deadline
+func (d *Dialer) RenameFolderContext(ctx context.Context, from string, to string) (err error) {
+	_, err = d.ExecContext(ctx, "RENAME "+d.mailbox(from)+" "+d.mailbox(to), false, nil)
+	return
+}
+
+// Subscribe adds a folder to the subscribed folders
+func (d *Dialer) Subscribe(folder string) (err error) {
+	return d.SubscribeContext(context.Background(), folder)
+}
+
+// SubscribeContext is Subscribe with a context that can cancel the command or set its deadline
+func (d *Dialer) SubscribeContext(ctx context.Context, folder string) (err error) {
+	_, err = d.ExecContext(ctx, "SUBSCRIBE "+d.mailbox(folder), false, nil)
+	return
+}
+
+// Unsubscribe removes a folder from the subscribed folders
+func (d *Dialer) Unsubscribe(folder string) (err error) {
+	return d.UnsubscribeContext(context.Background(), folder)
+}
+
+// UnsubscribeContext is Unsubscribe with a context that can cancel the command or set its deadline
+func (d *Dialer) UnsubscribeContext(ctx context.Context, folder string) (err error) {
+	_, err = d.ExecContext(ctx, "UNSUBSCRIBE "+d.mailbox(folder), false, nil)
+	return
+}
+
+// GetSubscribedFolders returns the subscribed folders, using LIST (SUBSCRIBED) when the server
+// supports LIST-EXTENDED (RFC 5258) and LSUB otherwise
+func (d *Dialer) GetSubscribedFolders() (folders []string, err error) {
+	return d.GetSubscribedFoldersContext(context.Background())
+}
+
+// GetSubscribedFoldersContext is GetSubscribedFolders with a context that can cancel the command or set its deadline
+func (d *Dialer) GetSubscribedFoldersContext(ctx context.Context) (folders []string, err error) {
+	var mailboxes []Mailbox
+	if d.has(ctx, "LIST-EXTENDED") {
+		mailboxes, err = d.list(ctx, `LIST (SUBSCRIBED) "" "*"`)
+	} else {
+		mailboxes, err = d.list(ctx, `LSUB "" "*"`)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mailboxNames(mailboxes), nil
+}
+
+// Delimiter returns the hierarchy delimiter used by the server to separate the parts of
+// folder names, e.g. "/" or ".", or "" if the server has a flat list of folders
+func (d *Dialer) Delimiter() (delimiter string, err error) {
+	return d.DelimiterContext(context.Background())
+}
+
+// DelimiterContext is Delimiter with a context that can cancel the command or set its deadline
+func (d *Dialer) DelimiterContext(ctx context.Context) (delimiter string, err error) {
+	if d.delimiter != nil {
+		return *d.delimiter, nil
+	}
+
+	// An empty pattern returns the delimiter of the root without listing any folders
+	mailboxes, err := d.list(ctx, `LIST "" ""`)
+	if err != nil {
+		return "", err
+	}
+	if len(mailboxes) != 0 {
+		delimiter = mailboxes[0].Delimiter
+	}
+
+	d.delimiter = &delimiter
+	return delimiter, nil
+}
+
+// FolderPath joins the parts of a folder name using the server's hierarchy delimiter,
+// e.g. FolderPath("Customers", "Acme") returns "Customers/Acme" or "Customers.Acme"
+func (d *Dialer) FolderPath(parts ...string) (folder string, err error) {
+	delimiter, err := d.Delimiter()
+	if err != nil {
+		return "", err
+	}
+	if delimiter == "" && len(parts) > 1 {
+		return "", fmt.Errorf("imap: server does not support folder hierarchies")
+	}
+	for _, p := range parts {
+		if delimiter != "" && strings.Contains(p, delimiter) {
+			return "", fmt.Errorf("imap: folder name %q contains the hierarchy delimiter %q", p, delimiter)
+		}
+	}
+	return strings.Join(parts, delimiter), nil
+}
+
+// Folder attributes returned by LIST (RFC 3501 and RFC 5258)
+const (
+	// AttrNoinferiors folders can not have child folders
+	AttrNoinferiors = `\Noinferiors`
+	// AttrNoselect folders can not be selected, they only exist as a parent of other folders
+	AttrNoselect = `\Noselect`
+	// AttrMarked folders have probably had messages added since they were last selected
+	AttrMarked = `\Marked`
+	// AttrUnmarked folders have not had messages added since they were last selected
+	AttrUnmarked = `\Unmarked`
+	// AttrNonExistent folders do not exist, e.g. a subscribed folder that has been deleted
+	AttrNonExistent = `\NonExistent`
+	// AttrSubscribed folders are subscribed
+	AttrSubscribed = `\Subscribed`
+	// AttrRemote folders are on a remote server
+	AttrRemote = `\Remote`
+	// AttrHasChildren folders have child folders
+	AttrHasChildren = `\HasChildren`
+	// AttrHasNoChildren folders have no child folders
+	AttrHasNoChildren = `\HasNoChildren`
+)
+
+// Mailbox is a folder returned by LIST
+type Mailbox struct {
+	// Name is the full name of the folder, including its parents
+	Name string
+	// Delimiter is the hierarchy delimiter, or "" if the server has a flat list of folders
+	Delimiter string
+	// Attributes are the attributes of the folder such as AttrNoselect or AttrHasChildren
+	Attributes []string
+	// Status is set by ListFoldersWithStatus for folders that can be selected
+	Status *MailboxStatus
+}
+
+// Has returns true if the folder has the attribute, ignoring case
+func (m Mailbox) Has(attr string) bool {
+	for _, a := range m.Attributes {
+		if strings.EqualFold(a, attr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Selectable returns true if the folder can be selected
+func (m Mailbox) Selectable() bool {
+	return !m.Has(AttrNoselect) && !m.Has(AttrNonExistent)
+}
+
+// Parent returns the full name of the parent folder, or "" for a top level folder
+func (m Mailbox) Parent() string {
+	if m.Delimiter == "" {
+		return ""
+	}
+	if i := strings.LastIndex(m.Name, m.Delimiter); i != -1 {
+		return m.Name[:i]
+	}
+	return ""
+}
+
+// BaseName returns the last part of the folder name, e.g. "Acme" for "Customers/Acme"
+func (m Mailbox) BaseName() string {
+	if m.Delimiter == "" {
+		return m.Name
+	}
+	if i := strings.LastIndex(m.Name, m.Delimiter); i != -1 {
+		return m.Name[i+len(m.Delimiter):]
+	}
+	return m.Name
+}
+
+func (m Mailbox) String() string {
+	return m.Name
+}
+
+// ListFolders returns the folders matching pattern relative to the reference name ref
+// (RFC 3501 6.3.8), in pattern "*" matches everything and "%" matches everything except the
+// hierarchy delimiter, so ListFolders("", "*") returns all folders and ListFolders("", "%")
+// returns the top level folders
+func (d *Dialer) ListFolders(ref string, pattern string) (mailboxes []Mailbox, err error) {
+	return d.ListFoldersContext(context.Background(), ref, pattern)
+}
+
+// ListFoldersContext is ListFolders with a context that can cancel the command or set its deadline
+func (d *Dialer) ListFoldersContext(ctx context.Context, ref string, pattern string) (mailboxes []Mailbox, err error) {
+	return d.list(ctx, "LIST "+d.mailbox(ref)+" "+d.mailbox(pattern))
+}
+
+// list runs a LIST or LSUB command and parses the folders from its response
+func (d *Dialer) list(ctx context.Context, command string) (mailboxes []Mailbox, err error) {
+	mailboxes = make([]Mailbox, 0)
+	_, err = d.ExecContext(ctx, command, false, func(line []byte) (err error) {
+		m, ok, err := parseListLine(line)
+		if err != nil || !ok {
+			return
+		}
+		m.Name = d.decodeMailbox(m.Name)
+		mailboxes = append(mailboxes, m)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mailboxes, nil
+}
+
+// parseListLine parses an untagged LIST or LSUB response, ok is false for other responses
+func parseListLine(line []byte) (m Mailbox, ok bool, err error) {
+	line = dropNl(line)
+	var rest []byte
+	switch {
+	case bytes.HasPrefix(line, []byte("* LIST ")):
+		rest = line[len("* LIST "):]
+	case bytes.HasPrefix(line, []byte("* LSUB ")):
+		rest = line[len("* LSUB "):]
+	default:
+		return
+	}
+
+	invalid := fmt.Errorf("imap: invalid LIST response %q", line)
+
+	// Attributes
+	if len(rest) == 0 || rest[0] != '(' {
+		return m, false, invalid
+	}
+	end := bytes.IndexByte(rest, ')')
+	if end == -1 {
+		return m, false, invalid
+	}
+	m.Attributes = strings.Fields(string(rest[1:end]))
+	rest = bytes.TrimLeft(rest[end+1:], " ")
+
+	// Delimiter
+	switch {
+	case bytes.HasPrefix(rest, []byte("NIL")):
+		rest = rest[len("NIL"):]
+	case bytes.HasPrefix(rest, []byte(`"\\"`)):
+		m.Delimiter = `\`
+		rest = rest[len(`"\\"`):]
+	case len(rest) >= 3 && rest[0] == '"' && rest[2] == '"':
+		m.Delimiter = string(rest[1:2])
+		rest = rest[3:]
+	default:
+		return m, false, invalid
+	}
+	rest = bytes.TrimLeft(rest, " ")
+
+	// Name, which may be a literal, a quoted string or an atom
+	if m.Name, _, err = parseAString(rest); err != nil {
+		return m, false, invalid
+	}
+
+	return m, true, nil
+}
+
+// parseAString parses an IMAP astring at the start of b (a literal, a quoted string
+// or an atom) returning it and the remainder of b
+func parseAString(b []byte) (s string, rest []byte, err error) {
+	if len(b) == 0 {
+		return "", b, fmt.Errorf("imap: missing string")
+	}
+	switch b[0] {
+	case '{':
+		end := bytes.Index(b, []byte("}"+nl))
+		if end == -1 {
+			return "", b, fmt.Errorf("imap: invalid literal")
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(string(b[1:end]), "+"))
+		if err != nil || end+len("}"+nl)+n > len(b) {
+			return "", b, fmt.Errorf("imap: invalid literal")
+		}
+		start := end + len("}"+nl)
+		return string(b[start : start+n]), b[start+n:], nil
+	case '"':
+		str := strings.Builder{}
+		for i := 1; i < len(b); i++ {
+			switch b[i] {
+			case '\\':
+				i++
+				if i < len(b) {
+					str.WriteByte(b[i])
+				}
+			case '"':
+				return str.String(), b[i+1:], nil
+			default:
+				str.WriteByte(b[i])
+			}
+		}
+		return "", b, fmt.Errorf("imap: unterminated quoted string")
+	}
+	end := bytes.IndexAny(b, " ()")
+	if end == -1 {
+		end = len(b)
+	}
+	if end == 0 {
+		return "", b, fmt.Errorf("imap: missing string")
+	}
+	return string(b[:end]), b[end:], nil
+}
+
+func mailboxNames(mailboxes []Mailbox) []string {
+	names := make([]string, len(mailboxes))
+	for i, m := range mailboxes {
+		names[i] = m.Name
+	}
+	return names
+}
+
+// MailboxNode is a folder in the tree returned by MailboxTree
+type MailboxNode struct {
+	Mailbox
+	Children []*MailboxNode
+}
+
+// MailboxTree arranges the folders returned by ListFolders into a tree using their hierarchy
+// delimiter, returning the top level folders in the order they were listed. When a parent
+// folder was not listed a node is added for it with the AttrNoselect attribute
+func MailboxTree(mailboxes []Mailbox) (roots []*MailboxNode) {
+	roots = make([]*MailboxNode, 0)
+	nodes := make(map[string]*MailboxNode, len(mailboxes))
+	placeholders := make(map[string]bool)
+
+	var add func(m Mailbox, placeholder bool) *MailboxNode
+	add = func(m Mailbox, placeholder bool) *MailboxNode {
+		if n, ok := nodes[m.Name]; ok {
+			if !placeholder && placeholders[m.Name] {
+				// The parent was listed after its child
+				n.Mailbox = m
+				delete(placeholders, m.Name)
+			}
+			return n
+		}
+		n := &MailboxNode{Mailbox: m, Children: make([]*MailboxNode, 0)}
+		nodes[m.Name] = n
+		if placeholder {
+			placeholders[m.Name] = true
+		}
+		if parent := m.Parent(); parent != "" {
+			p := add(Mailbox{Name: parent, Delimiter: m.Delimiter, Attributes: []string{AttrNoselect}}, true)
+			p.Children = append(p.Children, n)
+		} else {
+			roots = append(roots, n)
+		}
+		return n
+	}
+
+	for _, m := range mailboxes {
+		add(m, false)
+	}
+	return roots
+}
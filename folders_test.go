@@ -0,0 +1,158 @@
+package imap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseListLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want Mailbox
+	}{
+		{`* LIST (\HasNoChildren) "/" "INBOX"`, Mailbox{Name: "INBOX", Delimiter: "/", Attributes: []string{`\HasNoChildren`}}},
+		{`* LIST () "." INBOX`, Mailbox{Name: "INBOX", Delimiter: ".", Attributes: []string{}}},
+		{`* LSUB (\Noselect) "/" "Customers"`, Mailbox{Name: "Customers", Delimiter: "/", Attributes: []string{`\Noselect`}}},
+		// Quoted names with spaces and escapes
+		{`* LIST () "/" "Customers/Acme Ltd"`, Mailbox{Name: "Customers/Acme Ltd", Delimiter: "/", Attributes: []string{}}},
+		{`* LIST () "/" "Say \"hi\" \\ bye"`, Mailbox{Name: `Say "hi" \ bye`, Delimiter: "/", Attributes: []string{}}},
+		// Literal names, as returned by readLine with the literal appended
+		{"* LIST () \"/\" {11}\r\nFoo \"Bar\"/x", Mailbox{Name: `Foo "Bar"/x`, Delimiter: "/", Attributes: []string{}}},
+		{"* LIST () \"/\" {3+}\r\nFoo\r\n", Mailbox{Name: "Foo", Delimiter: "/", Attributes: []string{}}},
+		// A NIL delimiter for a flat list of folders, and a backslash delimiter
+		{`* LIST (\HasNoChildren) NIL "Archive"`, Mailbox{Name: "Archive", Attributes: []string{`\HasNoChildren`}}},
+		{`* LIST () "\\" "Customers\\Acme"`, Mailbox{Name: `Customers\Acme`, Delimiter: `\`, Attributes: []string{}}},
+		// Special-use attributes (RFC 6154) and CHILDINFO extended data (RFC 5258)
+		{`* LIST (\HasNoChildren \Sent) "/" "Sent Items"`, Mailbox{Name: "Sent Items", Delimiter: "/", Attributes: []string{`\HasNoChildren`, `\Sent`}}},
+		{`* LIST (\All \Noselect) "/" "[Gmail]/All Mail"`, Mailbox{Name: "[Gmail]/All Mail", Delimiter: "/", Attributes: []string{`\All`, `\Noselect`}}},
+		{`* LIST (\NonExistent) "/" "Foo" ("CHILDINFO" ("SUBSCRIBED"))`, Mailbox{Name: "Foo", Delimiter: "/", Attributes: []string{`\NonExistent`}}},
+		{`* LIST (\Subscribed \HasChildren) "/" Foo ("CHILDINFO" ("SUBSCRIBED"))`, Mailbox{Name: "Foo", Delimiter: "/", Attributes: []string{`\Subscribed`, `\HasChildren`}}},
+	}
+	for _, tt := range tests {
+		m, ok, err := parseListLine([]byte(tt.line + "\r\n"))
+		require.NoError(t, err, tt.line)
+		require.True(t, ok, tt.line)
+		require.Equal(t, tt.want, m, tt.line)
+	}
+
+	// Other responses are ignored
+	for _, line := range []string{`* STATUS "INBOX" (MESSAGES 1)`, "* 1 EXISTS", "A1 OK LIST done", `* LISTX () "/" INBOX`} {
+		_, ok, err := parseListLine([]byte(line + "\r\n"))
+		require.NoError(t, err, line)
+		require.False(t, ok, line)
+	}
+
+	for _, line := range []string{
+		`* LIST `,
+		`* LIST "/" INBOX`,
+		`* LIST (\HasNoChildren "/" INBOX`,
+		`* LIST () / INBOX`,
+		`* LIST () "/"`,
+		`* LIST () "/" "INBOX`,
+		"* LIST () \"/\" {10}\r\nshort",
+		`* LIST () "/" {x}`,
+	} {
+		_, _, err := parseListLine([]byte(line + "\r\n"))
+		require.Error(t, err, line)
+	}
+}
+
+func TestListFolders(t *testing.T) {
+	d, server := newPipeDialer(t)
+	commands := make(chan string, 10)
+	go scriptServer(server, map[string][]string{
+		`LIST "" "*"`: {
+			`* LIST (\HasChildren) "/" "Entw&APw-rfe"`,
+			"* LIST () \"/\" {16}\r\nEntw&APw-rfe/a b",
+			`* LIST (\HasNoChildren) "/" INBOX`,
+			"Done",
+		},
+	}, commands)
+
+	mailboxes, err := d.ListFolders("", "*")
+	require.NoError(t, err)
+	require.Equal(t, `LIST "" "*"`, <-commands)
+	require.Equal(t, []string{"Entwürfe", "Entwürfe/a b", "INBOX"}, mailboxNames(mailboxes))
+	require.Equal(t, "Entwürfe", mailboxes[1].Parent())
+	require.Equal(t, "a b", mailboxes[1].BaseName())
+}
+
+func TestMailbox(t *testing.T) {
+	m := Mailbox{Name: "Customers/Acme", Delimiter: "/", Attributes: []string{`\hasnochildren`}}
+	require.True(t, m.Has(AttrHasNoChildren))
+	require.False(t, m.Has(AttrHasChildren))
+	require.True(t, m.Selectable())
+	require.Equal(t, "Customers", m.Parent())
+	require.Equal(t, "Acme", m.BaseName())
+
+	flat := Mailbox{Name: "Customers/Acme"}
+	require.Equal(t, "", flat.Parent())
+	require.Equal(t, "Customers/Acme", flat.BaseName())
+
+	require.False(t, Mailbox{Name: "a", Attributes: []string{AttrNoselect}}.Selectable())
+	require.False(t, Mailbox{Name: "a", Attributes: []string{AttrNonExistent}}.Selectable())
+}
+
+// treeString formats a mailbox tree as the base name of each folder, with a ! for folders
+// which can't be selected, followed by its children in brackets, e.g. A(B! C)
+func treeString(nodes []*MailboxNode) string {
+	s := make([]string, len(nodes))
+	for i, n := range nodes {
+		s[i] = n.BaseName()
+		if !n.Selectable() {
+			s[i] += "!"
+		}
+		if len(n.Children) != 0 {
+			s[i] += "(" + treeString(n.Children) + ")"
+		}
+	}
+	return strings.Join(s, " ")
+}
+
+func TestMailboxTree(t *testing.T) {
+	mailbox := func(name string, attributes ...string) Mailbox {
+		return Mailbox{Name: name, Delimiter: "/", Attributes: attributes}
+	}
+	tests := []struct {
+		name      string
+		mailboxes []Mailbox
+		tree      string
+	}{
+		{"none", nil, ""},
+		{"flat", []Mailbox{mailbox("INBOX"), mailbox("Sent"), mailbox("Drafts")}, "INBOX Sent Drafts"},
+		{
+			"nested",
+			[]Mailbox{mailbox("INBOX"), mailbox("Customers"), mailbox("Customers/Acme"), mailbox("Customers/Acme/2024"), mailbox("Customers/Beta")},
+			"INBOX Customers(Acme(2024) Beta)",
+		},
+		{
+			"parent listed after its child",
+			[]Mailbox{mailbox("Customers/Acme"), mailbox("INBOX"), mailbox("Customers")},
+			"Customers(Acme) INBOX",
+		},
+		{
+			"missing parents",
+			[]Mailbox{mailbox("a/b/c"), mailbox("a/d")},
+			"a!(b!(c) d)",
+		},
+		{
+			"parent which can't be selected",
+			[]Mailbox{mailbox("[Gmail]", AttrNoselect), mailbox("[Gmail]/Sent Mail", `\Sent`)},
+			"[Gmail]!(Sent Mail)",
+		},
+		{
+			"no delimiter",
+			[]Mailbox{{Name: "a/b"}, {Name: "a"}},
+			"a/b a",
+		},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.tree, treeString(MailboxTree(tt.mailboxes)), tt.name)
+	}
+
+	// A placeholder is replaced by the listed folder
+	roots := MailboxTree([]Mailbox{mailbox("a/b"), mailbox("a", AttrHasChildren)})
+	require.Equal(t, []string{AttrHasChildren}, roots[0].Attributes)
+}
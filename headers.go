@@ -0,0 +1,110 @@
+package imap
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+)
+
+// FetchHeaders returns the header fields, e.g. List-Id or Authentication-Results, of the messages with
+// the given UIDs in the current folder by UID, without the rest of the messages. All the header fields
+// are returned if none are given. Values are as they are in the message, encoded words aren't decoded
+func (d *Dialer) FetchHeaders(uids UIDSet, fields ...string) (headers map[int]textproto.MIMEHeader, err error) {
+	return d.FetchHeadersContext(context.Background(), uids, fields...)
+}
+
+// FetchHeadersContext is FetchHeaders with a context that can cancel the command or set its deadline
+func (d *Dialer) FetchHeadersContext(ctx context.Context, uids UIDSet, fields ...string) (headers map[int]textproto.MIMEHeader, err error) {
+	section := "HEADER"
+	if len(fields) != 0 {
+		section = "HEADER.FIELDS"
+	}
+	return d.fetchHeaders(ctx, uids, section, fields)
+}
+
+// FetchHeadersExcept returns the header fields of the messages with the given UIDs in the current folder
+// by UID, except those given, e.g. Received, without the rest of the messages
+func (d *Dialer) FetchHeadersExcept(uids UIDSet, fields ...string) (headers map[int]textproto.MIMEHeader, err error) {
+	return d.FetchHeadersExceptContext(context.Background(), uids, fields...)
+}
+
+// FetchHeadersExceptContext is FetchHeadersExcept with a context that can cancel the command or set its deadline
+func (d *Dialer) FetchHeadersExceptContext(ctx context.Context, uids UIDSet, fields ...string) (headers map[int]textproto.MIMEHeader, err error) {
+	section := "HEADER"
+	if len(fields) != 0 {
+		section = "HEADER.FIELDS.NOT"
+	}
+	return d.fetchHeaders(ctx, uids, section, fields)
+}
+
+// fetchHeaders fetches the header section, HEADER, HEADER.FIELDS or HEADER.FIELDS.NOT, of the messages
+func (d *Dialer) fetchHeaders(ctx context.Context, uids UIDSet, section string, fields []string) (headers map[int]textproto.MIMEHeader, err error) {
+	if uids.Empty() {
+		return nil, fmt.Errorf("imap fetch: no UIDs given")
+	}
+	for _, f := range fields {
+		if !validHeaderField(f) {
+			return nil, fmt.Errorf("imap fetch: invalid header field %q", f)
+		}
+	}
+	if len(fields) != 0 {
+		section += " (" + strings.Join(fields, " ") + ")"
+	}
+
+	headers = make(map[int]textproto.MIMEHeader)
+	processLine := func(line []byte) (err error) {
+		if !isFetchLine(line) {
+			return
+		}
+		m, err := d.parseFetchMessage(line)
+		if err != nil || m.UID == 0 {
+			return
+		}
+		for name, t := range m.Items {
+			// The server may return the field names in a different case
+			if !strings.HasPrefix(strings.ToUpper(name), "BODY[HEADER") {
+				continue
+			}
+			if headers[m.UID], err = parseHeaderBlock(tokenString(t)); err != nil {
+				return fmt.Errorf("imap fetch: UID %d: %w", m.UID, err)
+			}
+		}
+		return
+	}
+	for _, set := range d.uidBatches(uids) {
+		if _, err = d.ExecContext(ctx, "UID FETCH "+set+" (UID BODY.PEEK["+section+"])", false, processLine); err != nil {
+			return nil, err
+		}
+	}
+
+	return headers, nil
+}
+
+// validHeaderField returns true if f is a header field name, which can be sent as an atom
+func validHeaderField(f string) bool {
+	if f == "" {
+		return false
+	}
+	for i := 0; i < len(f); i++ {
+		if f[i] <= ' ' || f[i] >= 0x7f || f[i] == ':' || strings.IndexByte(`()[]{}"\%*`, f[i]) != -1 {
+			return false
+		}
+	}
+	return true
+}
+
+// parseHeaderBlock parses a block of header fields ending with a blank line
+func parseHeaderBlock(block string) (textproto.MIMEHeader, error) {
+	if !strings.HasSuffix(block, "\r\n\r\n") && !strings.HasSuffix(block, "\n\n") {
+		// The blank line is missing when a message has no body
+		block += "\r\n\r\n"
+	}
+	header, err := textproto.NewReader(bufio.NewReader(strings.NewReader(block))).ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return header, nil
+}
@@ -0,0 +1,243 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultIdleRefresh is how often IDLE is re-issued when Dialer.IdleRefresh is not set,
+// servers may drop an idle connection after 30 minutes (RFC 2177)
+const DefaultIdleRefresh = 25 * time.Minute
+
+// idleDoneTimeout is how long to wait for the server to end IDLE after DONE is sent
+const idleDoneTimeout = 30 * time.Second
+
+// IdleEventType is the type of an update received while idling
+type IdleEventType uint8
+
+const (
+	// IdleExists is sent when the number of messages in the folder changes
+	IdleExists IdleEventType = iota
+	// IdleRecent is sent when the number of recent messages in the folder changes
+	IdleRecent
+	// IdleExpunge is sent when a message is removed from the folder
+	IdleExpunge
+	// IdleFetch is sent when the flags of a message change
+	IdleFetch
+)
+
+func (t IdleEventType) String() string {
+	switch t {
+	case IdleExists:
+		return "EXISTS"
+	case IdleRecent:
+		return "RECENT"
+	case IdleExpunge:
+		return "EXPUNGE"
+	case IdleFetch:
+		return "FETCH"
+	}
+	return ""
+}
+
+// IdleEvent is an untagged update received from the server while idling
+type IdleEvent struct {
+	Type IdleEventType
+	// Num is the message count for IdleExists and IdleRecent,
+	// and the message sequence number for IdleExpunge and IdleFetch
+	Num int
+	// UID is set for IdleFetch when the server includes it
+	UID int
+	// Flags is set for IdleFetch when the server includes them
+	Flags []string
+}
+
+func (e IdleEvent) String() string {
+	if e.Type == IdleFetch {
+		return fmt.Sprintf("%d %s (UID %d FLAGS %v)", e.Num, e.Type, e.UID, e.Flags)
+	}
+	return fmt.Sprintf("%d %s", e.Num, e.Type)
+}
+
+type idleResult struct {
+	line []byte
+	err  error
+}
+
+// Idle waits for updates to the selected folder using IDLE (RFC 2177), calling handler for
+// each one. IDLE is re-issued every IdleRefresh so the server does not drop the connection.
+// Idle returns when ctx is done, returning ctx.Err(), or when handler returns an error,
+// returning that error; in both cases IDLE is ended first so the Dialer can be used again.
+// No other commands can be run on the Dialer until Idle returns
+func (d *Dialer) Idle(ctx context.Context, handler func(event IdleEvent) error) (err error) {
+	refresh := d.IdleRefresh
+	if refresh <= 0 {
+		refresh = DefaultIdleRefresh
+	}
+
+	for {
+		var stop bool
+		if stop, err = d.idle(ctx, refresh, handler); stop || err != nil {
+			return
+		}
+		d.log(d.Folder, "re-issuing IDLE")
+	}
+}
+
+// idle runs a single IDLE command until it is refreshed, returning stop when Idle should return
+func (d *Dialer) idle(ctx context.Context, refresh time.Duration, handler func(event IdleEvent) error) (stop bool, err error) {
+	if d.broken {
+		return true, ErrConnectionBroken
+	}
+	if err = ctx.Err(); err != nil {
+		return true, err
+	}
+
+	tag := []byte(fmt.Sprintf("%X", bid2()))
+	d.log(d.Folder, fmt.Sprintf("-> %s IDLE", tag))
+	if _, err = d.conn.Write([]byte(fmt.Sprintf("%s IDLE\r\n", tag))); err != nil {
+		return true, err
+	}
+
+	// Lines are read in the background so IDLE can be ended while waiting for the server,
+	// the reader stops after the tagged response or an error and is always drained below
+	results := make(chan idleResult)
+	go func() {
+		for {
+			line, err := d.readLine()
+			results <- idleResult{line, err}
+			if err != nil || (len(line) >= 16 && bytes.Equal(line[:16], tag)) {
+				return
+			}
+		}
+	}()
+
+	timer := time.NewTimer(refresh)
+	defer timer.Stop()
+
+	ctxDone := ctx.Done()
+	cancelled := false
+	idling := false
+	doneSent := false
+	refreshDue := false
+	var handlerErr error
+
+	sendDone := func() {
+		if !idling || doneSent {
+			return
+		}
+		doneSent = true
+		d.log(d.Folder, "-> DONE")
+		d.conn.SetReadDeadline(time.Now().Add(idleDoneTimeout))
+		if _, err := d.conn.Write([]byte("DONE\r\n")); err != nil {
+			d.log(d.Folder, fmt.Sprintf("failed to send DONE: %s", err))
+		}
+	}
+
+	for {
+		select {
+		case r := <-results:
+			if r.err != nil {
+				d.log(d.Folder, fmt.Sprintf("idle failed, closing connection: %s", r.err))
+				d.broken = true
+				d.Close()
+				return true, r.err
+			}
+			line := dropNl(r.line)
+			d.log(d.Folder, fmt.Sprintf("<- %s", line))
+			d.updateSelected(line)
+
+			if len(line) >= 16 && bytes.Equal(line[:16], tag) {
+				d.conn.SetReadDeadline(time.Time{})
+				if len(line) < 19 || !bytes.Equal(line[17:19], []byte("OK")) {
+					return true, newCommandError(bytes.TrimSpace(line[16:]))
+				}
+				if handlerErr != nil {
+					return true, handlerErr
+				}
+				if cancelled {
+					return true, ctx.Err()
+				}
+				return false, nil
+			}
+
+			if len(line) >= 1 && line[0] == '+' {
+				idling = true
+				if handlerErr != nil || cancelled || refreshDue {
+					sendDone()
+				}
+				continue
+			}
+
+			if handlerErr != nil {
+				continue
+			}
+			event, ok, err := d.parseIdleEvent(line)
+			if err != nil {
+				handlerErr = err
+			} else if ok {
+				handlerErr = handler(event)
+			}
+			if handlerErr != nil {
+				sendDone()
+			}
+		case <-ctxDone:
+			// ctx.Done() is nil for a context that can't be cancelled, so cancelled is tracked separately
+			ctxDone = nil
+			cancelled = true
+			sendDone()
+		case <-timer.C:
+			refreshDue = true
+			sendDone()
+		}
+	}
+}
+
+// parseIdleEvent parses an untagged response line, ok is false for lines that are not updates
+func (d *Dialer) parseIdleEvent(line []byte) (event IdleEvent, ok bool, err error) {
+	fields := strings.Fields(string(line))
+	if len(fields) < 3 || fields[0] != "*" {
+		return
+	}
+	num, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return event, false, nil
+	}
+	event.Num = num
+
+	switch strings.ToUpper(fields[2]) {
+	case "EXISTS":
+		event.Type = IdleExists
+	case "RECENT":
+		event.Type = IdleRecent
+	case "EXPUNGE":
+		event.Type = IdleExpunge
+	case "FETCH":
+		event.Type = IdleFetch
+		records, err := d.ParseFetchResponse(string(line) + nl)
+		if err != nil {
+			return event, false, err
+		}
+		for _, tks := range records {
+			for i := 0; i+1 < len(tks); i++ {
+				switch tks[i].Str {
+				case "UID":
+					event.UID = tks[i+1].Num
+				case "FLAGS":
+					event.Flags = make([]string, 0, len(tks[i+1].Tokens))
+					for _, t := range tks[i+1].Tokens {
+						event.Flags = append(event.Flags, t.Str)
+					}
+				}
+			}
+		}
+	default:
+		return
+	}
+
+	return event, true, nil
+}
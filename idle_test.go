@@ -0,0 +1,71 @@
+package imap
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newPipeDialer returns a Dialer connected to the server end of a pipe
+func newPipeDialer(t *testing.T) (*Dialer, net.Conn) {
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return &Dialer{conn: client, reader: bufio.NewReader(client), connected: true}, server
+}
+
+func TestIdleBackgroundContext(t *testing.T) {
+	d, server := newPipeDialer(t)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- func() error {
+			r := bufio.NewReader(server)
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return err
+			}
+			tag := strings.Fields(line)[0]
+			if _, err = server.Write([]byte("+ idling\r\n")); err != nil {
+				return err
+			}
+
+			// The client must keep idling, DONE is only expected once the handler returns an error
+			server.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			if line, err = r.ReadString('\n'); err == nil {
+				return errors.New("unexpected line while idling: " + line)
+			}
+			server.SetReadDeadline(time.Time{})
+
+			if _, err = server.Write([]byte("* 3 EXISTS\r\n")); err != nil {
+				return err
+			}
+			if line, err = r.ReadString('\n'); err != nil {
+				return err
+			}
+			if line != "DONE\r\n" {
+				return errors.New("expected DONE, got " + line)
+			}
+			_, err = server.Write([]byte(tag + " OK IDLE terminated\r\n"))
+			return err
+		}()
+	}()
+
+	errStop := errors.New("stop")
+	events := make([]IdleEvent, 0)
+	err := d.Idle(context.Background(), func(event IdleEvent) error {
+		events = append(events, event)
+		return errStop
+	})
+	require.ErrorIs(t, err, errStop)
+	require.NoError(t, <-serverErr)
+	require.Equal(t, []IdleEvent{{Type: IdleExists, Num: 3}}, events)
+}
@@ -0,0 +1,203 @@
+package imap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// errIteratorClosed aborts a fetch when its FetchIterator is closed early
+var errIteratorClosed = errors.New("imap fetch: iterator closed")
+
+// FetchMessage is a message returned by a FetchIterator
+type FetchMessage struct {
+	// SeqNum is the message sequence number
+	SeqNum int
+	UID    int
+	// Items are the fetched items by the name the server returned them with, e.g. FLAGS or BODY[]
+	Items map[string]*Token
+}
+
+// FetchIterator reads the messages of a fetch one at a time as they arrive from the server,
+// so only one message is held in memory however many are fetched. It is used like a bufio.Scanner:
+//
+//	it := im.FetchIter(uids, "FLAGS", "BODY.PEEK[]")
+//	defer it.Close()
+//	for it.Next() {
+//		m := it.Message()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// The Dialer must not be used for anything else until Next returns false or Close is called.
+// Closing the iterator before the fetch has finished closes the connection, see Close
+type FetchIterator struct {
+	messages chan *FetchMessage
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	current  *FetchMessage
+	err      error
+}
+
+// FetchIter fetches the items, e.g. FLAGS, ENVELOPE or BODY.PEEK[], for the messages with the given
+// UIDs in the current folder, 1:* for every message, returning an iterator which parses each
+// message as it arrives. UID is always fetched
+func (d *Dialer) FetchIter(uids UIDSet, items ...string) *FetchIterator {
+	return d.FetchIterContext(context.Background(), uids, items...)
+}
+
+// FetchIterContext is FetchIter with a context that can cancel the command or set its deadline
+func (d *Dialer) FetchIterContext(ctx context.Context, uids UIDSet, items ...string) *FetchIterator {
+	it := &FetchIterator{
+		messages: make(chan *FetchMessage),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	if uids.Empty() {
+		it.err = fmt.Errorf("imap fetch: no UIDs given")
+		close(it.messages)
+		close(it.done)
+		return it
+	}
+
+	sets := d.uidBatches(uids)
+	fetch := " (" + strings.Join(append([]string{"UID"}, items...), " ") + ")"
+
+	go func() {
+		defer close(it.messages)
+		processLine := func(line []byte) (err error) {
+			if !isFetchLine(line) {
+				return
+			}
+			m, err := d.parseFetchMessage(line)
+			if err != nil {
+				return err
+			}
+			select {
+			case it.messages <- m:
+			case <-it.stop:
+				return errIteratorClosed
+			}
+			return
+		}
+		for _, set := range sets {
+			if _, it.err = d.ExecContext(ctx, "UID FETCH "+set+fetch, false, processLine); it.err != nil {
+				break
+			}
+		}
+		if it.err == errIteratorClosed {
+			// Reading the rest of the response could mean downloading the whole folder
+			d.log(d.Folder, "fetch iterator closed early, closing connection")
+			d.broken = true
+			d.Close()
+			it.err = nil
+		}
+		close(it.done)
+	}()
+
+	return it
+}
+
+// Next waits for the next message, returning false when there are no more or an error occurred
+func (it *FetchIterator) Next() bool {
+	m, ok := <-it.messages
+	it.current = m
+	return ok
+}
+
+// Message returns the message read by the last call to Next
+func (it *FetchIterator) Message() *FetchMessage {
+	return it.current
+}
+
+// Err returns the error that ended the fetch, if any, once Next has returned false
+func (it *FetchIterator) Err() error {
+	select {
+	case <-it.done:
+		return it.err
+	default:
+		return nil
+	}
+}
+
+// Close stops the iterator and returns the error that ended the fetch, if any. If the fetch hasn't
+// finished the rest of the response isn't read, as it could be the rest of the folder, so the
+// connection is closed and the Dialer must be reconnected before it can be used again
+func (it *FetchIterator) Close() error {
+	it.stopOnce.Do(func() { close(it.stop) })
+	for range it.messages {
+	}
+	it.current = nil
+	return it.err
+}
+
+// parseFetchMessage parses a FETCH response line into a FetchMessage
+func (d *Dialer) parseFetchMessage(line []byte) (*FetchMessage, error) {
+	fields := strings.SplitN(string(line), " ", 3)
+	seq, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("imap fetch: invalid sequence number in %q", fields[1])
+	}
+
+	records, err := d.ParseFetchResponse(string(line))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &FetchMessage{
+		SeqNum: seq,
+		Items:  make(map[string]*Token),
+	}
+	for _, tks := range records {
+		for i := 0; i+1 < len(tks); i += 2 {
+			if err = d.CheckType(tks[i], []TType{TLiteral}, tks, "in root"); err != nil {
+				return nil, err
+			}
+			name := tks[i].Str
+			if strings.Contains(name, "[") && !strings.Contains(name, "]") {
+				// A section with a list of header fields is split into several tokens,
+				// e.g. BODY[HEADER.FIELDS (LIST-ID)]
+				name, i = joinSectionName(tks, i)
+				if i+1 >= len(tks) {
+					break
+				}
+			}
+			m.Items[name] = tks[i+1]
+			if name == "UID" && tks[i+1].Type == TNumber {
+				m.UID = tks[i+1].Num
+			}
+		}
+	}
+	return m, nil
+}
+
+// joinSectionName joins the tokens of a section name starting at tks[i] up to its closing ],
+// returning the name and the index of its last token
+func joinSectionName(tks []*Token, i int) (string, int) {
+	name := strings.Builder{}
+	name.WriteString(tks[i].Str)
+	for i+1 < len(tks) {
+		i++
+		t := tks[i]
+		if t.Type == TContainer {
+			fields := make([]string, len(t.Tokens))
+			for j, f := range t.Tokens {
+				fields[j] = tokenString(f)
+			}
+			name.WriteString(" (" + strings.Join(fields, " ") + ")")
+			continue
+		}
+		name.WriteString(tokenString(t))
+		if strings.Contains(t.Str, "]") {
+			break
+		}
+	}
+	return name.String(), i
+}
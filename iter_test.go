@@ -0,0 +1,72 @@
+package imap
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// iterServer answers a UID FETCH with count messages, or without end if count is 0,
+// and OK for anything else. It returns when the connection is closed
+func iterServer(server net.Conn, count int) {
+	r := bufio.NewReader(server)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		tag, command, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if strings.HasPrefix(command, "UID FETCH ") {
+			for uid := 1; count == 0 || uid <= count; uid++ {
+				if _, err = fmt.Fprintf(server, "* %d FETCH (UID %d FLAGS (\\Seen))\r\n", uid, uid); err != nil {
+					return
+				}
+			}
+		}
+		fmt.Fprintf(server, "%s OK done\r\n", tag)
+	}
+}
+
+func TestFetchIter(t *testing.T) {
+	d, server := newPipeDialer(t)
+	go iterServer(server, 3)
+
+	all := UIDSet{}
+	all.AddRange(1, Star)
+	it := d.FetchIter(all, "FLAGS")
+	uids := make([]int, 0)
+	for it.Next() {
+		m := it.Message()
+		uids = append(uids, m.UID)
+		require.Equal(t, m.UID, m.SeqNum)
+		require.Equal(t, `\Seen`, tokenString(m.Items["FLAGS"].Tokens[0]))
+	}
+	require.NoError(t, it.Err())
+	require.NoError(t, it.Close())
+	require.Equal(t, []int{1, 2, 3}, uids)
+
+	// The Dialer can be used again
+	_, err := d.Exec("NOOP", false, nil)
+	require.NoError(t, err)
+}
+
+func TestFetchIterCloseEarly(t *testing.T) {
+	d, server := newPipeDialer(t)
+	go iterServer(server, 0)
+
+	all := UIDSet{}
+	all.AddRange(1, Star)
+	it := d.FetchIter(all, "FLAGS")
+	require.True(t, it.Next())
+	require.Equal(t, 1, it.Message().UID)
+
+	// The server never finishes, so Close returns only because it doesn't read the rest
+	require.NoError(t, it.Close())
+	require.False(t, it.Next())
+	_, err := d.Exec("NOOP", false, nil)
+	require.ErrorIs(t, err, ErrConnectionBroken)
+}
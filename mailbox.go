@@ -0,0 +1,140 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+)
+
+// MailboxStatus is the state of a folder as returned by SelectFolder, ExamineFolder and Status
+type MailboxStatus struct {
+	// Name is the name of the folder
+	Name string
+	// ReadOnly is true when the folder was selected by ExamineFolder or the server
+	// only allows read only access
+	ReadOnly bool
+	// Flags are the flags that can be used in the folder
+	Flags []string
+	// PermanentFlags are the flags that can be changed permanently, including `\*` if
+	// new keywords can be created
+	PermanentFlags []string
+	// Messages is the number of messages in the folder (EXISTS)
+	Messages int
+	// Recent is the number of messages with the \Recent flag
+	Recent int
+	// FirstUnseen is the sequence number of the first unseen message, or 0 if unknown
+	FirstUnseen int
+	// UIDNext is the predicted next UID, or 0 if unknown
+	UIDNext int
+	// UIDValidity is the UIDVALIDITY of the folder, when it changes previously seen UIDs
+	// no longer refer to the same messages
+	UIDValidity int
+	// HighestModSeq is the highest mod-sequence of the folder when the server supports CONDSTORE
+	HighestModSeq uint64
+	// Unseen is the number of messages without the \Seen flag, only returned by Status
+	Unseen int
+	// Size is the total size of the messages in bytes, only returned by Status when the
+	// server supports STATUS=SIZE (RFC 8438)
+	Size int64
+	// Deleted is the number of messages with the \Deleted flag, only returned by Status
+	// when the server supports IMAP4rev2
+	Deleted int
+}
+
+// selectFolder runs SELECT or EXAMINE and returns the state of the folder
+func (d *Dialer) selectFolder(ctx context.Context, command string, folder string) (status *MailboxStatus, err error) {
+	d.selected = &MailboxStatus{Name: folder, ReadOnly: command == "EXAMINE"}
+	_, result, err := d.exec(ctx, command+" "+d.mailbox(folder), false, nil, nil)
+	if err != nil {
+		// A failed SELECT or EXAMINE leaves no folder selected
+		d.selected = nil
+		return nil, err
+	}
+	switch code, _ := responseCode(result); code {
+	case "READ-ONLY":
+		d.selected.ReadOnly = true
+	case "READ-WRITE":
+		d.selected.ReadOnly = false
+	}
+	d.Folder = folder
+
+	return d.Selected(), nil
+}
+
+// Selected returns the state of the selected folder, which is kept up to date from the
+// responses to later commands. Nil is returned if no folder is selected
+func (d *Dialer) Selected() *MailboxStatus {
+	if d.selected == nil {
+		return nil
+	}
+	status := *d.selected
+	status.Flags = append([]string(nil), d.selected.Flags...)
+	status.PermanentFlags = append([]string(nil), d.selected.PermanentFlags...)
+	return &status
+}
+
+// updateSelected updates the state of the selected folder from an untagged response
+func (d *Dialer) updateSelected(line []byte) {
+	if d.selected == nil || !bytes.HasPrefix(line, []byte("* ")) {
+		return
+	}
+	l := dropNl(line[2:])
+
+	switch {
+	case bytes.HasPrefix(l, []byte("FLAGS ")):
+		d.selected.Flags = parseFlagList(string(l[len("FLAGS "):]))
+		return
+	case bytes.HasPrefix(l, []byte("OK [")):
+		code, args := responseCode(string(l[len("OK "):]))
+		switch code {
+		case "PERMANENTFLAGS":
+			d.selected.PermanentFlags = parseFlagList(args)
+		case "UNSEEN":
+			d.selected.FirstUnseen, _ = strconv.Atoi(args)
+		case "UIDNEXT":
+			d.selected.UIDNext, _ = strconv.Atoi(args)
+		case "UIDVALIDITY":
+			d.selected.UIDValidity, _ = strconv.Atoi(args)
+		case "HIGHESTMODSEQ":
+			d.selected.HighestModSeq, _ = strconv.ParseUint(args, 10, 64)
+		}
+		return
+	}
+
+	// Only the start of the line is split, as other lines with a number such as FETCH
+	// responses can contain whole messages
+	fields := bytes.SplitN(l, []byte(" "), 3)
+	if len(fields) != 2 {
+		return
+	}
+	n, err := strconv.Atoi(string(fields[0]))
+	if err != nil {
+		return
+	}
+	switch strings.ToUpper(string(fields[1])) {
+	case "EXISTS":
+		d.selected.Messages = n
+	case "RECENT":
+		d.selected.Recent = n
+	case "EXPUNGE":
+		if d.selected.Messages > 0 {
+			d.selected.Messages--
+		}
+		if d.selected.FirstUnseen == n {
+			d.selected.FirstUnseen = 0
+		} else if d.selected.FirstUnseen > n {
+			d.selected.FirstUnseen--
+		}
+	}
+}
+
+// parseFlagList parses a parenthesized list of flags such as (\Seen \Deleted)
+func parseFlagList(s string) []string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "(")
+	if i := strings.IndexByte(s, ')'); i != -1 {
+		s = s[:i]
+	}
+	return strings.Fields(s)
+}
@@ -0,0 +1,60 @@
+package imap
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateSelected(t *testing.T) {
+	tests := []struct {
+		line string
+		want MailboxStatus
+	}{
+		{"* 172 EXISTS\r\n", MailboxStatus{Messages: 172, FirstUnseen: 12}},
+		{"* 1 recent\r\n", MailboxStatus{Messages: 10, Recent: 1, FirstUnseen: 12}},
+		{"* 3 EXPUNGE\r\n", MailboxStatus{Messages: 9, FirstUnseen: 11}},
+		{"* 12 EXPUNGE\r\n", MailboxStatus{Messages: 9}},
+		{"* 20 EXPUNGE\r\n", MailboxStatus{Messages: 9, FirstUnseen: 12}},
+		{`* FLAGS (\Answered \Seen $Label)` + "\r\n", MailboxStatus{Messages: 10, FirstUnseen: 12, Flags: []string{`\Answered`, `\Seen`, "$Label"}}},
+		{`* OK [PERMANENTFLAGS (\Seen \*)] Limited` + "\r\n", MailboxStatus{Messages: 10, FirstUnseen: 12, PermanentFlags: []string{`\Seen`, `\*`}}},
+		{"* OK [UNSEEN 4] First unseen\r\n", MailboxStatus{Messages: 10, FirstUnseen: 4}},
+		{"* OK [UIDNEXT 4392] Predicted next UID\r\n", MailboxStatus{Messages: 10, FirstUnseen: 12, UIDNext: 4392}},
+		{"* OK [UIDVALIDITY 3857529045] UIDs valid\r\n", MailboxStatus{Messages: 10, FirstUnseen: 12, UIDValidity: 3857529045}},
+		{"* OK [HIGHESTMODSEQ 715194045007] Highest\r\n", MailboxStatus{Messages: 10, FirstUnseen: 12, HighestModSeq: 715194045007}},
+		// Responses which don't change the state
+		{"* 3 FETCH (FLAGS (\\Seen))\r\n", MailboxStatus{Messages: 10, FirstUnseen: 12}},
+		{"* 3 EXISTS more\r\n", MailboxStatus{Messages: 10, FirstUnseen: 12}},
+		{"* x EXISTS\r\n", MailboxStatus{Messages: 10, FirstUnseen: 12}},
+		{"* OK Still here\r\n", MailboxStatus{Messages: 10, FirstUnseen: 12}},
+		{"A1 OK [UIDNEXT 5] done\r\n", MailboxStatus{Messages: 10, FirstUnseen: 12}},
+		{"+ idling\r\n", MailboxStatus{Messages: 10, FirstUnseen: 12}},
+	}
+	for _, tt := range tests {
+		d := &Dialer{selected: &MailboxStatus{Messages: 10, FirstUnseen: 12}}
+		d.updateSelected([]byte(tt.line))
+		require.Equal(t, tt.want, *d.selected, tt.line)
+	}
+
+	// Nothing is updated without a selected folder
+	d := &Dialer{}
+	d.updateSelected([]byte("* 172 EXISTS\r\n"))
+	require.Nil(t, d.selected)
+}
+
+func TestUpdateSelectedLargeFetch(t *testing.T) {
+	body := strings.Repeat("a line of a large message body\r\n", 1<<18)
+	line := []byte("* 1 FETCH (UID 1 BODY[] {" + strconv.Itoa(len(body)) + "}\r\n" + body + ")\r\n")
+	d := &Dialer{selected: &MailboxStatus{}}
+
+	// The line isn't copied to look at its start
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	d.updateSelected(line)
+	runtime.ReadMemStats(&after)
+	require.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(len(line)/4))
+	require.Equal(t, MailboxStatus{}, *d.selected)
+}
@@ -3,12 +3,15 @@ package imap
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"mime"
 	"net"
+	"net/textproto"
 	"regexp"
 	"strconv"
 	"strings"
@@ -26,18 +29,41 @@ var AddSlashes = strings.NewReplacer(`"`, `\"`)
 // RemoveSlashes removes slashes before double quotes
 var RemoveSlashes = strings.NewReplacer(`\"`, `"`)
 
+// quote returns s as an IMAP quoted string, escaping backslashes and double quotes
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
 // Dialer is basically an IMAP connection
 type Dialer struct {
-	conn      net.Conn
-	Folder    string
-	Username  string
-	Password  string
-	Host      string
-	Port      int
-	strtokI   int
-	strtok    string
-	connected bool
-	Logger    *log.Logger
+	conn         net.Conn
+	reader       *bufio.Reader
+	Folder       string
+	Username     string
+	Password     string
+	Host         string
+	Port         int
+	strtokI      int
+	strtok       string
+	connected    bool
+	broken       bool
+	capabilities []string
+	delimiter    *string
+	utf8Accept   bool
+	selected     *MailboxStatus
+	Logger       *log.Logger
+	// RawMailboxNames disables the modified UTF-7 encoding of folder names sent to the server
+	// and the decoding of those received from it
+	RawMailboxNames bool
+	// Auth when set is used by the Connect methods to authenticate instead of LOGIN
+	Auth SASLMechanism
+	// IdleRefresh is how often Idle re-issues IDLE, DefaultIdleRefresh is used when zero
+	IdleRefresh time.Duration
+	// BatchSize is the most UIDs or UID ranges sent in one command, longer lists are split
+	// into several commands. DefaultBatchSize is used when zero
+	BatchSize int
+	// IncludeHeaders makes GetOverviews and GetEmails fetch the full header block of each message into Email.Header
+	IncludeHeaders bool
 }
 
 // EmailAddresses are a map of email address to names
@@ -45,13 +71,17 @@ type EmailAddresses map[string]string
 
 // Email is an email message
 type Email struct {
-	Flags       []string
-	Received    time.Time
-	Sent        time.Time
-	Size        uint64
-	Subject     string
-	UID         int
-	MessageID   string
+	Flags      []string
+	Received   time.Time
+	Sent       time.Time
+	Size       uint64
+	Subject    string
+	UID        int
+	MessageID  string
+	InReplyTo  string
+	References []string
+	// Header is the full header block, only set when Dialer.IncludeHeaders is set
+	Header      textproto.MIMEHeader
 	From        EmailAddresses
 	To          EmailAddresses
 	ReplyTo     EmailAddresses
@@ -157,10 +187,11 @@ func (d *Dialer) Connect() error {
 		d.log("", fmt.Sprintf("failed to connect: %s", err))
 		return err
 	}
-	d.conn = conn
-	d.connected = true
+	if err = d.setConn(conn); err != nil {
+		return err
+	}
 
-	return d.Login(d.Username, d.Password)
+	return d.authenticate()
 }
 
 // Connect attempts to connect and login a direct TCP connection with no TLS security typically on port 143
@@ -173,10 +204,11 @@ func (d *Dialer) ConnectNoTls() error {
 		d.log("", fmt.Sprintf("failed to connect: %s", err))
 		return err
 	}
-	d.conn = conn
-	d.connected = true
+	if err = d.setConn(conn); err != nil {
+		return err
+	}
 
-	return d.Login(d.Username, d.Password)
+	return d.authenticate()
 }
 
 // ConnectAuto trys to connect using TLS, else with TLS skipping cert verification else with no TLS
@@ -207,10 +239,116 @@ func (d *Dialer) ConnectWithTlsConfig(config *tls.Config) error {
 		d.log("", fmt.Sprintf("failed to connect: %s", err))
 		return err
 	}
+	if err = d.setConn(conn); err != nil {
+		return err
+	}
+
+	return d.authenticate()
+}
+
+// ConnectStartTLS connects without TLS typically on port 143, then upgrades the connection
+// using STARTTLS before logging in. Unlike ConnectAuto it never falls back to plain text,
+// an error is returned if the server does not offer STARTTLS
+func (d *Dialer) ConnectStartTLS(config *tls.Config) error {
+	d.log("", "establishing connection with STARTTLS")
+
+	hostAndPort := d.Host + ":" + strconv.Itoa(d.Port)
+	conn, err := net.Dial("tcp", hostAndPort)
+	if err != nil {
+		d.log("", fmt.Sprintf("failed to connect: %s", err))
+		return err
+	}
+	if err = d.setConn(conn); err != nil {
+		return err
+	}
+
+	if err = d.StartTLS(config); err != nil {
+		d.Close()
+		return err
+	}
+
+	return d.authenticate()
+}
+
+// StartTLS upgrades the current connection to TLS using the STARTTLS command
+// and then refreshes the server capabilities
+func (d *Dialer) StartTLS(config *tls.Config) (err error) {
+	return d.StartTLSContext(context.Background(), config)
+}
+
+// StartTLSContext is StartTLS with a context that can cancel the command or set its deadline
+func (d *Dialer) StartTLSContext(ctx context.Context, config *tls.Config) (err error) {
+	if _, ok := d.conn.(*tls.Conn); ok {
+		return fmt.Errorf("imap starttls: connection is already using TLS")
+	}
+
+	capabilities, err := d.CapabilitiesContext(ctx)
+	if err != nil {
+		return
+	}
+	if !hasCapability(capabilities, "STARTTLS") {
+		return fmt.Errorf("imap starttls: not supported by the server")
+	}
+
+	if _, err = d.ExecContext(ctx, "STARTTLS", false, nil); err != nil {
+		return
+	}
+
+	// Anything buffered before the handshake was injected in plain text
+	if d.reader.Buffered() != 0 {
+		return fmt.Errorf("imap starttls: unexpected data received before TLS handshake")
+	}
+
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" && !config.InsecureSkipVerify {
+		config = config.Clone()
+		config.ServerName = d.Host
+	}
+
+	conn := tls.Client(d.conn, config)
+	if err = conn.HandshakeContext(ctx); err != nil {
+		return fmt.Errorf("imap starttls: %s", err)
+	}
+	d.conn = conn
+	d.reader = bufio.NewReader(conn)
+
+	// Capabilities learnt before STARTTLS must be discarded (RFC 3501 6.2.1)
+	d.capabilities = nil
+	_, err = d.CapabilityContext(ctx)
+	return
+}
+
+// setConn makes conn the active connection and reads the server greeting
+func (d *Dialer) setConn(conn net.Conn) (err error) {
 	d.conn = conn
+	d.reader = bufio.NewReader(conn)
 	d.connected = true
+	d.broken = false
+	d.capabilities = nil
+	d.delimiter = nil
+	d.utf8Accept = false
+	d.selected = nil
 
-	return d.Login(d.Username, d.Password)
+	line, err := d.reader.ReadBytes('\n')
+	if err != nil {
+		d.Close()
+		return fmt.Errorf("imap greeting: %s", err)
+	}
+	line = dropNl(line)
+	d.log("", fmt.Sprintf("<- %s", line))
+
+	if bytes.HasPrefix(line, []byte("* BYE")) {
+		d.Close()
+		return fmt.Errorf("imap greeting: server refused connection: %s", line)
+	}
+	if !bytes.HasPrefix(line, []byte("* OK")) && !bytes.HasPrefix(line, []byte("* PREAUTH")) {
+		d.Close()
+		return fmt.Errorf("imap greeting: unexpected response: %s", line)
+	}
+	d.updateCapabilities(line)
+	return nil
 }
 
 func (d *Dialer) log(folder string, msg interface{}) {
@@ -247,65 +385,162 @@ func dropNl(b []byte) []byte {
 
 var atom = regexp.MustCompile(`{\d+}$`)
 
+// ErrConnectionBroken is returned by commands run on a connection where a previous command was
+// aborted part way through by its context or a closed FetchIterator, the Dialer must be reconnected
+var ErrConnectionBroken = errors.New("imap: connection broken by an aborted command")
+
+// CommandError is returned when the server completes a command with NO or BAD
+type CommandError struct {
+	// Status is NO or BAD
+	Status string
+	// Text is the human readable text of the response including any response code
+	Text string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("imap command failed: %s", e.Text)
+}
+
+// newCommandError returns a CommandError from a tagged response with the tag removed
+func newCommandError(resp []byte) *CommandError {
+	status, text, _ := strings.Cut(string(dropNl(resp)), " ")
+	return &CommandError{Status: status, Text: text}
+}
+
+// responseCode returns the response code and its arguments from the text of a status response,
+// e.g. "[UIDNEXT 4392] Predicted next UID" returns "UIDNEXT" and "4392"
+func responseCode(text string) (code string, args string) {
+	if !strings.HasPrefix(text, "[") {
+		return "", ""
+	}
+	end := strings.IndexByte(text, ']')
+	if end == -1 {
+		return "", ""
+	}
+	code, args, _ = strings.Cut(text[1:end], " ")
+	return strings.ToUpper(code), args
+}
+
+// watchContext applies the deadline of ctx to the connection and interrupts any blocked
+// read or write when ctx is cancelled. The returned func must be called once the command
+// has finished; if *err is a timeout caused by ctx the connection is closed and marked broken
+// as the rest of the response has been abandoned, and *err is replaced by the context error
+func (d *Dialer) watchContext(ctx context.Context, err *error) func() {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		d.conn.SetDeadline(deadline)
+	}
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			d.conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+		d.conn.SetDeadline(time.Time{})
+
+		var ne net.Error
+		if *err != nil && errors.As(*err, &ne) && ne.Timeout() {
+			d.log(d.Folder, fmt.Sprintf("command aborted, closing connection: %s", *err))
+			d.broken = true
+			d.Close()
+			if ctx.Err() != nil {
+				*err = ctx.Err()
+			}
+		}
+	}
+}
+
 // Exec executes the command on the imap connection
 func (d *Dialer) Exec(command string, buildResponse bool, processLine func(line []byte) error) (response string, err error) {
+	return d.ExecContext(context.Background(), command, buildResponse, processLine)
+}
+
+// ExecContext is Exec with a context that can cancel the command or set its deadline
+func (d *Dialer) ExecContext(ctx context.Context, command string, buildResponse bool, processLine func(line []byte) error) (response string, err error) {
+	response, _, err = d.exec(ctx, command, buildResponse, processLine, nil)
+	return
+}
+
+// exec executes the command, calling continuation for each continuation request (a line starting
+// with "+") from the server and sending what it returns, which must include the trailing CRLF.
+// As well as the response it returns the text of the tagged OK response, e.g. to read response codes
+func (d *Dialer) exec(ctx context.Context, command string, buildResponse bool, processLine func(line []byte) error, continuation func(line []byte) ([]byte, error)) (response string, result string, err error) {
+	if d.broken {
+		return "", "", ErrConnectionBroken
+	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	defer d.watchContext(ctx, &err)()
+
 	var resp strings.Builder
 	tag := []byte(fmt.Sprintf("%X", bid2()))
 
 	c := fmt.Sprintf("%s %s\r\n", tag, command)
 
-	d.log(d.Folder, strings.Replace(fmt.Sprintf("%s %s", "->", strings.TrimSpace(c)), fmt.Sprintf(`"%s"`, d.Password), `"****"`, -1))
+	if strings.HasPrefix(command, "AUTHENTICATE ") && strings.Count(command, " ") > 1 {
+		// Don't log the SASL initial response as it contains credentials
+		d.log(d.Folder, fmt.Sprintf("-> %s %s ****", tag, command[:strings.LastIndexByte(command, ' ')]))
+	} else if i := strings.Index(command, nl); i != -1 {
+		// Only log the first line of commands containing non-synchronizing literals
+		d.log(d.Folder, fmt.Sprintf("-> %s %s [%d bytes]", tag, command[:i], len(command)-i-len(nl)))
+	} else {
+		d.log(d.Folder, strings.Replace(fmt.Sprintf("%s %s", "->", strings.TrimSpace(c)), fmt.Sprintf(`"%s"`, d.Password), `"****"`, -1))
+	}
 
 	_, err = d.conn.Write([]byte(c))
 	if err != nil {
 		return
 	}
 
-	r := bufio.NewReader(d.conn)
-
 	if buildResponse {
 		resp = strings.Builder{}
 	}
 	var line []byte
 	for err == nil {
-		line, err = r.ReadBytes('\n')
-		for {
-			if a := atom.Find(dropNl(line)); a != nil {
-				// fmt.Printf("%s\n", a)
-				var n int
-				n, err = strconv.Atoi(string(a[1 : len(a)-1]))
-				if err != nil {
-					return
-				}
-
-				buf := make([]byte, n)
-				_, err = io.ReadFull(r, buf)
-				if err != nil {
-					return
-				}
-				line = append(line, buf...)
-
-				buf, err = r.ReadBytes('\n')
-				if err != nil {
-					return
-				}
-				line = append(line, buf...)
-
-				continue
-			}
-			break
+		line, err = d.readLine()
+		if err != nil {
+			return
 		}
 
 		d.log(d.Folder, fmt.Sprintf("<- %s", dropNl(line)))
 
+		d.updateCapabilities(line)
+		d.updateSelected(line)
+
 		if len(line) >= 19 && bytes.Equal(line[:16], tag) {
 			if !bytes.Equal(line[17:19], []byte("OK")) {
-				err = fmt.Errorf("imap command failed: %s", line[20:])
+				err = newCommandError(line[17:])
 				return
 			}
+			result = strings.TrimPrefix(string(dropNl(line[17:])), "OK ")
 			break
 		}
 
+		if continuation != nil && len(line) >= 1 && line[0] == '+' {
+			var b []byte
+			if b, err = continuation(dropNl(line)); err != nil {
+				return
+			}
+			d.log(d.Folder, fmt.Sprintf("-> [%d bytes]", len(b)))
+			if _, err = d.conn.Write(b); err != nil {
+				return
+			}
+			continue
+		}
+
 		if processLine != nil {
 			if err = processLine(line); err != nil {
 				return
@@ -317,87 +552,109 @@ func (d *Dialer) Exec(command string, buildResponse bool, processLine func(line
 	}
 
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	if buildResponse {
 		if resp.Len() != 0 {
-			return resp.String(), nil
+			return resp.String(), result, nil
 		}
-		return "", nil
+		return "", result, nil
+	}
+	return
+}
+
+// readLine reads the next response line from the server, including any literals it contains
+func (d *Dialer) readLine() (line []byte, err error) {
+	r := d.reader
+	line, err = r.ReadBytes('\n')
+	for {
+		if a := atom.Find(dropNl(line)); a != nil {
+			// fmt.Printf("%s\n", a)
+			var n int
+			n, err = strconv.Atoi(string(a[1 : len(a)-1]))
+			if err != nil {
+				return
+			}
+
+			buf := make([]byte, n)
+			_, err = io.ReadFull(r, buf)
+			if err != nil {
+				return
+			}
+			line = append(line, buf...)
+
+			buf, err = r.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			line = append(line, buf...)
+
+			continue
+		}
+		break
 	}
 	return
 }
 
 // Login attempts to login
 func (d *Dialer) Login(username string, password string) (err error) {
-	_, err = d.Exec(fmt.Sprintf(`LOGIN "%s" "%s"`, AddSlashes.Replace(username), AddSlashes.Replace(password)), false, nil)
+	return d.LoginContext(context.Background(), username, password)
+}
+
+// LoginContext is Login with a context that can cancel the command or set its deadline
+func (d *Dialer) LoginContext(ctx context.Context, username string, password string) (err error) {
+	// Capabilities may change after login, the server normally sends them with its response
+	d.capabilities = nil
+	_, err = d.ExecContext(ctx, fmt.Sprintf(`LOGIN "%s" "%s"`, AddSlashes.Replace(username), AddSlashes.Replace(password)), false, nil)
 	return
 }
 
 // GetFolders returns all folders
 func (d *Dialer) GetFolders() (folders []string, err error) {
-	folders = make([]string, 0)
-	_, err = d.Exec(`LIST "" "*"`, false, func(line []byte) (err error) {
-		line = dropNl(line)
-		if b := bytes.IndexByte(line, '\n'); b != -1 {
-			folders = append(folders, string(line[b+1:]))
-		} else {
-			i := len(line) - 1
-			if len(line) == 0 {
-				return
-			}
-			quoted := line[i] == '"'
-			delim := byte(' ')
-			if quoted {
-				delim = '"'
-				i--
-			}
-			end := i
-			for i > 0 {
-				if line[i] == delim {
-					if !quoted || line[i-1] != '\\' {
-						break
-					}
-				}
-				i--
-			}
-			folders = append(folders, RemoveSlashes.Replace(string(line[i+1:end+1])))
-		}
-		return
-	})
+	return d.GetFoldersContext(context.Background())
+}
+
+// GetFoldersContext is GetFolders with a context that can cancel the command or set its deadline
+func (d *Dialer) GetFoldersContext(ctx context.Context) (folders []string, err error) {
+	mailboxes, err := d.ListFoldersContext(ctx, "", "*")
 	if err != nil {
 		return nil, err
 	}
+	return mailboxNames(mailboxes), nil
+}
 
-	return folders, nil
+// SelectFolder selects a folder, returning its state such as the number of messages and UIDVALIDITY
+func (d *Dialer) SelectFolder(folder string) (status *MailboxStatus, err error) {
+	return d.SelectFolderContext(context.Background(), folder)
 }
 
-// SelectFolder selects a folder
-func (d *Dialer) SelectFolder(folder string) (err error) {
-	_, err = d.Exec(`SELECT "`+AddSlashes.Replace(folder)+`"`, true, nil)
-	if err != nil {
-		return
-	}
-	d.Folder = folder
-	return nil
+// SelectFolderContext is SelectFolder with a context that can cancel the command or set its deadline
+func (d *Dialer) SelectFolderContext(ctx context.Context, folder string) (status *MailboxStatus, err error) {
+	return d.selectFolder(ctx, "SELECT", folder)
 }
 
-// ExamineFolder selects a folder in read only mode
-func (d *Dialer) ExamineFolder(folder string) (err error) {
-	_, err = d.Exec(`EXAMINE "`+AddSlashes.Replace(folder)+`"`, true, nil)
-	if err != nil {
-		return
-	}
-	d.Folder = folder
-	return nil
+// ExamineFolder selects a folder in read only mode, returning its state such as the number of
+// messages and UIDVALIDITY
+func (d *Dialer) ExamineFolder(folder string) (status *MailboxStatus, err error) {
+	return d.ExamineFolderContext(context.Background(), folder)
+}
+
+// ExamineFolderContext is ExamineFolder with a context that can cancel the command or set its deadline
+func (d *Dialer) ExamineFolderContext(ctx context.Context, folder string) (status *MailboxStatus, err error) {
+	return d.selectFolder(ctx, "EXAMINE", folder)
 }
 
 // GetUIDs returns the UIDs in the current folder that match the search
 func (d *Dialer) GetUIDs(search string) (uids []int, err error) {
+	return d.GetUIDsContext(context.Background(), search)
+}
+
+// GetUIDsContext is GetUIDs with a context that can cancel the command or set its deadline
+func (d *Dialer) GetUIDsContext(ctx context.Context, search string) (uids []int, err error) {
 	uids = make([]int, 0)
 	t := []byte{' ', '\r', '\n'}
-	r, err := d.Exec(`UID SEARCH `+search, true, nil)
+	r, err := d.ExecContext(ctx, `UID SEARCH `+search, true, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -442,7 +699,33 @@ const (
 // GetEmails returns email with their bodies for the given UIDs in the current folder.
 // If no UIDs are given, they everything in the current folder is selected
 func (d *Dialer) GetEmails(uids ...int) (emails map[int]*Email, err error) {
-	emails, err = d.GetOverviews(uids...)
+	return d.GetEmailsContext(context.Background(), uids...)
+}
+
+// GetEmailsContext is GetEmails with a context that can cancel the command or set its deadline
+func (d *Dialer) GetEmailsContext(ctx context.Context, uids ...int) (emails map[int]*Email, err error) {
+	set, none := requestedUIDs(uids)
+	if none {
+		return
+	}
+	return d.getEmails(ctx, nil, set)
+}
+
+// GetEmailsSet is GetEmails for the UIDs in the set, e.g. 500:*, which must not be empty.
+// Use 1:* for everything in the current folder
+func (d *Dialer) GetEmailsSet(uids UIDSet) (emails map[int]*Email, err error) {
+	return d.GetEmailsSetContext(context.Background(), uids)
+}
+
+// GetEmailsSetContext is GetEmailsSet with a context that can cancel the command or set its deadline
+func (d *Dialer) GetEmailsSetContext(ctx context.Context, uids UIDSet) (emails map[int]*Email, err error) {
+	return d.getEmails(ctx, nil, uids)
+}
+
+// getEmails fetches emails with their bodies, calling skipped for each email which is
+// left out because its body could not be parsed
+func (d *Dialer) getEmails(ctx context.Context, skipped func(uid int, err error), uids UIDSet) (emails map[int]*Email, err error) {
+	emails, err = d.GetOverviewsSetContext(ctx, uids)
 	if err != nil {
 		return nil, err
 	}
@@ -451,26 +734,14 @@ func (d *Dialer) GetEmails(uids ...int) (emails map[int]*Email, err error) {
 		return
 	}
 
-	uidsStr := strings.Builder{}
-	if len(uids) == 0 {
-		uidsStr.WriteString("1:*")
-	} else {
-		i := 0
-		for u := range emails {
-			if u == 0 {
-				continue
-			}
-
-			if i != 0 {
-				uidsStr.WriteByte(',')
-			}
-			uidsStr.WriteString(strconv.Itoa(u))
-			i++
-		}
+	found := make([]int, 0, len(emails))
+	for u := range emails {
+		found = append(found, u)
 	}
+	fetch := NewUIDSet(found...)
 
 	var records [][]*Token
-	r, err := d.Exec("UID FETCH "+uidsStr.String()+" BODY.PEEK[]", true, nil)
+	r, err := d.fetchBatches(ctx, fetch, "BODY.PEEK[]")
 	if err != nil {
 		return
 	}
@@ -484,6 +755,7 @@ func (d *Dialer) GetEmails(uids ...int) (emails map[int]*Email, err error) {
 		e := &Email{}
 		skip := 0
 		success := true
+		var bodyErr error
 		for i, t := range tks {
 			if skip > 0 {
 				skip--
@@ -504,11 +776,13 @@ func (d *Dialer) GetEmails(uids ...int) (emails map[int]*Email, err error) {
 				if err != nil {
 					d.log(d.Folder, "email body could not be parsed, skipping: "+err.Error())
 					success = false
+					bodyErr = err
 
 					// continue RecL
 				} else {
 
 					e.Subject = env.GetHeader("Subject")
+					e.References = parseMessageIDs(env.GetHeader("References"))
 					e.Text = env.Text
 					e.HTML = env.HTML
 
@@ -559,8 +833,13 @@ func (d *Dialer) GetEmails(uids ...int) (emails map[int]*Email, err error) {
 			}
 		}
 
+		if _, ok := emails[e.UID]; !ok {
+			// Expunged since the overview was fetched
+			continue
+		}
 		if success {
 			emails[e.UID].Subject = e.Subject
+			emails[e.UID].References = e.References
 			emails[e.UID].From = e.From
 			emails[e.UID].ReplyTo = e.ReplyTo
 			emails[e.UID].To = e.To
@@ -571,6 +850,9 @@ func (d *Dialer) GetEmails(uids ...int) (emails map[int]*Email, err error) {
 			emails[e.UID].Attachments = e.Attachments
 		} else {
 			delete(emails, e.UID)
+			if skipped != nil {
+				skipped(e.UID, bodyErr)
+			}
 		}
 	}
 	return
@@ -579,24 +861,33 @@ func (d *Dialer) GetEmails(uids ...int) (emails map[int]*Email, err error) {
 // GetOverviews returns emails without bodies for the given UIDs in the current folder.
 // If no UIDs are given, they everything in the current folder is selected
 func (d *Dialer) GetOverviews(uids ...int) (emails map[int]*Email, err error) {
-	uidsStr := strings.Builder{}
-	if len(uids) == 0 {
-		uidsStr.WriteString("1:*")
-	} else {
-		for i, u := range uids {
-			if u == 0 {
-				continue
-			}
+	return d.GetOverviewsContext(context.Background(), uids...)
+}
 
-			if i != 0 {
-				uidsStr.WriteByte(',')
-			}
-			uidsStr.WriteString(strconv.Itoa(u))
-		}
+// GetOverviewsContext is GetOverviews with a context that can cancel the command or set its deadline
+func (d *Dialer) GetOverviewsContext(ctx context.Context, uids ...int) (emails map[int]*Email, err error) {
+	set, none := requestedUIDs(uids)
+	if none {
+		return
 	}
+	return d.GetOverviewsSetContext(ctx, set)
+}
 
+// GetOverviewsSet is GetOverviews for the UIDs in the set, e.g. 500:*, which must not be empty.
+// Use 1:* for everything in the current folder
+func (d *Dialer) GetOverviewsSet(uids UIDSet) (emails map[int]*Email, err error) {
+	return d.GetOverviewsSetContext(context.Background(), uids)
+}
+
+// GetOverviewsSetContext is GetOverviewsSet with a context that can cancel the command or set its deadline
+func (d *Dialer) GetOverviewsSetContext(ctx context.Context, uids UIDSet) (emails map[int]*Email, err error) {
 	var records [][]*Token
-	r, err := d.Exec("UID FETCH "+uidsStr.String()+" ALL", true, nil)
+	items := "ALL"
+	if d.IncludeHeaders {
+		// ALL is a macro for these, which can't be combined with other items
+		items = "(FLAGS INTERNALDATE RFC822.SIZE ENVELOPE BODY.PEEK[HEADER])"
+	}
+	r, err := d.fetchBatches(ctx, uids, items)
 	if err != nil {
 		return
 	}
@@ -610,13 +901,8 @@ func (d *Dialer) GetOverviews(uids ...int) (emails map[int]*Email, err error) {
 		return nil, err
 	}
 
-	emails = make(map[int]*Email, len(uids))
-	CharsetReader := func(label string, input io.Reader) (io.Reader, error) {
-		label = strings.Replace(label, "windows-", "cp", -1)
-		encoding, _ := charset.Lookup(label)
-		return encoding.NewDecoder().Reader(input), nil
-	}
-	dec := mime.WordDecoder{CharsetReader: CharsetReader}
+	emails = make(map[int]*Email, len(records))
+	dec := mime.WordDecoder{CharsetReader: charsetReader}
 
 	// RecordsL:
 	for _, tks := range records {
@@ -659,6 +945,15 @@ func (d *Dialer) GetOverviews(uids ...int) (emails map[int]*Email, err error) {
 				}
 				e.Size = uint64(tks[i+1].Num)
 				skip++
+			case "BODY[HEADER]":
+				if err = d.CheckType(tks[i+1], []TType{TAtom, TQuoted, TNil}, tks, "after BODY[HEADER]"); err != nil {
+					return nil, err
+				}
+				e.Header, err = parseHeaderBlock(tks[i+1].Str)
+				if err != nil {
+					return nil, err
+				}
+				skip++
 			case "ENVELOPE":
 				if err = d.CheckType(tks[i+1], []TType{TContainer}, tks, "after ENVELOPE"); err != nil {
 					return nil, err
@@ -732,6 +1027,7 @@ func (d *Dialer) GetOverviews(uids ...int) (emails map[int]*Email, err error) {
 				}
 
 				e.MessageID = tks[i+1].Tokens[EMessageID].Str
+				e.InReplyTo = tks[i+1].Tokens[EInReplyTo].Str
 
 				skip++
 			case "UID":
@@ -749,6 +1045,16 @@ func (d *Dialer) GetOverviews(uids ...int) (emails map[int]*Email, err error) {
 	return
 }
 
+// charsetReader converts input in the named charset to UTF-8, for decoding encoded words in headers
+func charsetReader(label string, input io.Reader) (io.Reader, error) {
+	label = strings.Replace(label, "windows-", "cp", -1)
+	encoding, _ := charset.Lookup(label)
+	if encoding == nil {
+		return nil, fmt.Errorf("imap: unknown charset %q", label)
+	}
+	return encoding.NewDecoder().Reader(input), nil
+}
+
 // Token is a fetch response token (e.g. a number, or a quoted section, or a container, etc.)
 type Token struct {
 	Type   TType
@@ -914,6 +1220,10 @@ func (d *Dialer) ParseFetchResponse(r string) (records [][]*Token, err error) {
 					currentToken = TContainer
 					t := pushToken()
 					depth++
+					if depth == len(container) {
+						// e.g. a BODYSTRUCTURE of nested multiparts
+						container = append(container, nil)
+					}
 					container[depth] = &t.Tokens
 				case b == ')':
 					depth--
@@ -949,12 +1259,16 @@ func IsLiteral(b rune) bool {
 		b == '\\',
 		b == '.',
 		b == '[',
-		b == ']':
+		b == ']',
+		strings.ContainsRune(atomPunctuation, b):
 		return true
 	}
 	return false
 }
 
+// atomPunctuation are the other characters allowed in an atom, e.g. the $ in the keyword $Forwarded
+const atomPunctuation = "!#$&'+,-/:;<=>?@^_`|~"
+
 // GetTokenName returns the name of the given token type token
 func GetTokenName(tokenType TType) string {
 	switch tokenType {
@@ -0,0 +1,213 @@
+package imap
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CopyUID is the mapping of UIDs returned by servers supporting UIDPLUS (RFC 4315)
+// when messages are copied or moved to another folder
+type CopyUID struct {
+	// UIDValidity is the UIDVALIDITY of the destination folder
+	UIDValidity int
+	// UIDs maps each source UID to its UID in the destination folder
+	UIDs map[int]int
+}
+
+// CopyUIDs copies the messages with the given UIDs in the current folder to folder.
+// The UID mapping is returned when the server provides it, otherwise it is nil
+func (d *Dialer) CopyUIDs(uids UIDSet, folder string) (copyUID *CopyUID, err error) {
+	return d.CopyUIDsContext(context.Background(), uids, folder)
+}
+
+// CopyUIDsContext is CopyUIDs with a context that can cancel the command or set its deadline
+func (d *Dialer) CopyUIDsContext(ctx context.Context, uids UIDSet, folder string) (copyUID *CopyUID, err error) {
+	if uids.Empty() {
+		return nil, fmt.Errorf("imap copy: no UIDs given")
+	}
+
+	for i, set := range d.uidBatches(uids) {
+		_, result, err := d.exec(ctx, "UID COPY "+set+" "+d.mailbox(folder), false, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		c, err := parseCopyUID(result)
+		if err != nil {
+			return nil, err
+		}
+		copyUID = mergeCopyUID(copyUID, c, i == 0)
+	}
+
+	return copyUID, nil
+}
+
+// MoveUIDs moves the messages with the given UIDs in the current folder to folder.
+// MOVE (RFC 6851) is used when the server supports it, otherwise when the server supports
+// UIDPLUS the messages are copied, marked as \Deleted and then expunged with UID EXPUNGE.
+// The UID mapping is returned when the server provides it, otherwise it is nil
+func (d *Dialer) MoveUIDs(uids UIDSet, folder string) (copyUID *CopyUID, err error) {
+	return d.MoveUIDsContext(context.Background(), uids, folder)
+}
+
+// MoveUIDsContext is MoveUIDs with a context that can cancel the command or set its deadline
+func (d *Dialer) MoveUIDsContext(ctx context.Context, uids UIDSet, folder string) (copyUID *CopyUID, err error) {
+	if uids.Empty() {
+		return nil, fmt.Errorf("imap move: no UIDs given")
+	}
+
+	if !d.has(ctx, "MOVE") {
+		if !d.has(ctx, "UIDPLUS") {
+			// A plain EXPUNGE would also remove any other messages marked as \Deleted
+			return nil, fmt.Errorf("imap move: server supports neither MOVE nor UIDPLUS")
+		}
+
+		if copyUID, err = d.CopyUIDsContext(ctx, uids, folder); err != nil {
+			return nil, err
+		}
+		if _, err = d.StoreFlagsContext(ctx, uids, FlagsAdd, true, FlagDeleted); err != nil {
+			return nil, err
+		}
+		if err = d.expungeUIDs(ctx, uids); err != nil {
+			return nil, err
+		}
+		return copyUID, nil
+	}
+
+	for i, set := range d.uidBatches(uids) {
+		// The COPYUID response code is sent in an untagged OK before the EXPUNGE responses
+		var c *CopyUID
+		_, result, err := d.exec(ctx, "UID MOVE "+set+" "+d.mailbox(folder), false, func(line []byte) (err error) {
+			if l := string(dropNl(line)); c == nil && strings.HasPrefix(l, "* OK [") {
+				c, err = parseCopyUID(l[len("* OK "):])
+			}
+			return
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		if c == nil {
+			if c, err = parseCopyUID(result); err != nil {
+				return nil, err
+			}
+		}
+		copyUID = mergeCopyUID(copyUID, c, i == 0)
+	}
+
+	return copyUID, nil
+}
+
+// mergeCopyUID adds the UIDs of the next batch to c, the first batch's mapping when first is set.
+// The result is nil unless the server returned a mapping for every batch
+func mergeCopyUID(c *CopyUID, next *CopyUID, first bool) *CopyUID {
+	if first {
+		return next
+	}
+	if c == nil || next == nil {
+		return nil
+	}
+	for src, dst := range next.UIDs {
+		c.UIDs[src] = dst
+	}
+	return c
+}
+
+// Expunge permanently removes the messages with the given UIDs which are marked as \Deleted from
+// the current folder using UID EXPUNGE, which requires UIDPLUS. Use ExpungeAll to remove every
+// message marked as \Deleted
+func (d *Dialer) Expunge(uids UIDSet) (err error) {
+	return d.ExpungeContext(context.Background(), uids)
+}
+
+// ExpungeContext is Expunge with a context that can cancel the command or set its deadline
+func (d *Dialer) ExpungeContext(ctx context.Context, uids UIDSet) (err error) {
+	if uids.Empty() {
+		return fmt.Errorf("imap expunge: no UIDs given")
+	}
+	return d.expungeUIDs(ctx, uids)
+}
+
+// ExpungeAll permanently removes every message marked as \Deleted from the current folder
+func (d *Dialer) ExpungeAll() (err error) {
+	return d.ExpungeAllContext(context.Background())
+}
+
+// ExpungeAllContext is ExpungeAll with a context that can cancel the command or set its deadline
+func (d *Dialer) ExpungeAllContext(ctx context.Context) (err error) {
+	_, err = d.ExecContext(ctx, "EXPUNGE", false, nil)
+	return
+}
+
+// expungeUIDs removes the messages with the given UIDs which are marked as \Deleted using UID EXPUNGE
+func (d *Dialer) expungeUIDs(ctx context.Context, uids UIDSet) (err error) {
+	for _, set := range d.uidBatches(uids) {
+		if _, err = d.ExecContext(ctx, "UID EXPUNGE "+set, false, nil); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// parseCopyUID parses the COPYUID response code from the text of a status response,
+// returning nil if it has none
+func parseCopyUID(text string) (*CopyUID, error) {
+	code, args := responseCode(text)
+	if code != "COPYUID" {
+		return nil, nil
+	}
+
+	fields := strings.Fields(args)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("imap: invalid COPYUID response code %q", args)
+	}
+	uidValidity, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("imap: invalid COPYUID response code %q", args)
+	}
+	src, err := parseUIDList(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	dst, err := parseUIDList(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	if len(src) != len(dst) {
+		return nil, fmt.Errorf("imap: invalid COPYUID response code %q", args)
+	}
+
+	c := &CopyUID{
+		UIDValidity: uidValidity,
+		UIDs:        make(map[int]int, len(src)),
+	}
+	for i, uid := range src {
+		c.UIDs[uid] = dst[i]
+	}
+	return c, nil
+}
+
+// parseUIDList expands a list of UIDs and UID ranges such as "304,319:320" in order
+func parseUIDList(s string) (uids []int, err error) {
+	uids = make([]int, 0)
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(part, ":")
+		start, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("imap: invalid UID list %q", s)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(to); err != nil {
+				return nil, fmt.Errorf("imap: invalid UID list %q", s)
+			}
+		}
+		if start > end {
+			start, end = end, start
+		}
+		for u := start; u <= end; u++ {
+			uids = append(uids, u)
+		}
+	}
+	return uids, nil
+}
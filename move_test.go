@@ -0,0 +1,137 @@
+package imap
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// scriptServer answers each command with the untagged lines and the tagged OK text in its reply,
+// or a plain OK if it has none, sending the commands it received on commands
+func scriptServer(server net.Conn, replies map[string][]string, commands chan<- string) {
+	defer close(commands)
+	r := bufio.NewReader(server)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		tag, command, _ := strings.Cut(strings.TrimSpace(line), " ")
+		commands <- command
+		ok := "done"
+		if reply := replies[command]; len(reply) != 0 {
+			for _, l := range reply[:len(reply)-1] {
+				fmt.Fprintf(server, "%s\r\n", l)
+			}
+			ok = reply[len(reply)-1]
+		}
+		fmt.Fprintf(server, "%s OK %s\r\n", tag, ok)
+	}
+}
+
+func TestResponseCode(t *testing.T) {
+	tests := []struct {
+		text, code, args string
+	}{
+		{"[UIDNEXT 4392] Predicted next UID", "UIDNEXT", "4392"},
+		{"[copyuid 38505 304 3956] Done", "COPYUID", "38505 304 3956"},
+		{"[READ-WRITE] SELECT completed", "READ-WRITE", ""},
+		{"[PERMANENTFLAGS (\\Seen \\*)] Limited", "PERMANENTFLAGS", "(\\Seen \\*)"},
+		{"Completed", "", ""},
+		{"[UIDNEXT 4392 Predicted", "", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		code, args := responseCode(tt.text)
+		require.Equal(t, tt.code, code, tt.text)
+		require.Equal(t, tt.args, args, tt.text)
+	}
+}
+
+func TestParseCopyUID(t *testing.T) {
+	tests := []struct {
+		text        string
+		uidValidity int
+		uids        map[int]int
+	}{
+		// The examples from RFC 4315
+		{"[COPYUID 38505 304,319:320 3956:3958] Done", 38505, map[int]int{304: 3956, 319: 3957, 320: 3958}},
+		{"[COPYUID 38505 304 3956] Done", 38505, map[int]int{304: 3956}},
+		{"[copyuid 1 1:3 10:12] Done", 1, map[int]int{1: 10, 2: 11, 3: 12}},
+		// Reversed ranges are in ascending order
+		{"[COPYUID 1 3:1 12:10] Done", 1, map[int]int{1: 10, 2: 11, 3: 12}},
+		{"[COPYUID 1 5,1 7,8]", 1, map[int]int{5: 7, 1: 8}},
+	}
+	for _, tt := range tests {
+		c, err := parseCopyUID(tt.text)
+		require.NoError(t, err, tt.text)
+		require.Equal(t, &CopyUID{UIDValidity: tt.uidValidity, UIDs: tt.uids}, c, tt.text)
+	}
+
+	// Without UIDPLUS there is no COPYUID response code
+	for _, text := range []string{"Done", "[READ-WRITE] Done", "", "[APPENDUID 38505 3955] Done"} {
+		c, err := parseCopyUID(text)
+		require.NoError(t, err, text)
+		require.Nil(t, c, text)
+	}
+
+	for _, text := range []string{
+		"[COPYUID] Done",
+		"[COPYUID 38505 304] Done",
+		"[COPYUID 38505 304 3956 1] Done",
+		"[COPYUID x 304 3956] Done",
+		"[COPYUID 38505 a 3956] Done",
+		"[COPYUID 38505 304 3956:b] Done",
+		"[COPYUID 38505 304,, 3956] Done",
+		"[COPYUID 38505 304:305 3956] Done",
+	} {
+		_, err := parseCopyUID(text)
+		require.Error(t, err, text)
+	}
+}
+
+func TestCopyUIDs(t *testing.T) {
+	d, server := newPipeDialer(t)
+	d.BatchSize = 1
+	commands := make(chan string, 10)
+	go scriptServer(server, map[string][]string{
+		`UID COPY 1:2 "Archive"`: {"[COPYUID 7 1:2 101:102] Done"},
+		`UID COPY 5 "Archive"`:   {"[COPYUID 7 5 105] Done"},
+		`UID MOVE 1:2 "Archive"`: {"* OK [COPYUID 7 1:2 101:102] Moved", "* 1 EXPUNGE", "* 1 EXPUNGE", "Done"},
+		`UID MOVE 5 "Archive"`:   {"* 3 EXPUNGE", "[COPYUID 7 5 105] Done"},
+	}, commands)
+
+	set := NewUIDSet(1, 2, 5)
+	c, err := d.CopyUIDs(set, "Archive")
+	require.NoError(t, err)
+	require.Equal(t, `UID COPY 1:2 "Archive"`, <-commands)
+	require.Equal(t, `UID COPY 5 "Archive"`, <-commands)
+	require.Equal(t, &CopyUID{UIDValidity: 7, UIDs: map[int]int{1: 101, 2: 102, 5: 105}}, c)
+
+	// The mapping is nil when any batch doesn't have one
+	c, err = d.CopyUIDs(NewUIDSet(5, 7), "Archive")
+	require.NoError(t, err)
+	require.Equal(t, `UID COPY 5 "Archive"`, <-commands)
+	require.Equal(t, `UID COPY 7 "Archive"`, <-commands)
+	require.Nil(t, c)
+
+	// MOVE sends COPYUID in an untagged OK or in the tagged OK
+	d.capabilities = []string{"IMAP4rev1", "MOVE"}
+	c, err = d.MoveUIDs(set, "Archive")
+	require.NoError(t, err)
+	require.Equal(t, `UID MOVE 1:2 "Archive"`, <-commands)
+	require.Equal(t, `UID MOVE 5 "Archive"`, <-commands)
+	require.Equal(t, &CopyUID{UIDValidity: 7, UIDs: map[int]int{1: 101, 2: 102, 5: 105}}, c)
+
+	// Without MOVE or UIDPLUS messages aren't moved, as EXPUNGE would remove other deleted messages
+	d.capabilities = []string{"IMAP4rev1"}
+	_, err = d.MoveUIDs(set, "Archive")
+	require.Error(t, err)
+
+	_, err = d.CopyUIDs(UIDSet{}, "Archive")
+	require.Error(t, err)
+}
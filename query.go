@@ -0,0 +1,367 @@
+package imap
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseQuery parses a Gmail style search query into search criteria, e.g.
+//
+//	from:alice subject:"invoice 42" after:2024/01/01 has:attachment is:unread
+//
+// Terms are combined with AND, and can be combined with OR, grouped with ( ) or { } (any of the terms),
+// and negated with a leading -. Words and "quoted phrases" without an operator search the whole message.
+// The supported operators are from:, to:, cc:, bcc:, subject:, list:, deliveredto:, rfc822msgid:,
+// after: (or since:), before:, on:, older_than:, newer_than:, larger: (or size:), smaller:,
+// has:attachment and is: with read, unread, starred, unstarred, flagged, answered, draft or deleted.
+// Dates are written as 2024/01/31 or 2024-01-31 and sizes as bytes or with a K, M or G suffix.
+// has:attachment matches multipart/mixed messages, which is how most attachments are sent.
+// Any other operator is an error
+func ParseQuery(query string) (*Search, error) {
+	p := &queryParser{tokens: tokenizeQuery(query)}
+	s, err := p.parseAll()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("imap query: unexpected %q", p.tokens[p.pos].text)
+	}
+	return s, nil
+}
+
+// SearchQuery returns the UIDs in the current folder matching the Gmail style query. On Gmail
+// (X-GM-EXT-1) the query is sent as it is with X-GM-RAW so all of Gmail's operators are supported,
+// otherwise it is translated to search criteria by ParseQuery
+func (d *Dialer) SearchQuery(query string) (uids []int, err error) {
+	return d.SearchQueryContext(context.Background(), query)
+}
+
+// SearchQueryContext is SearchQuery with a context that can cancel the command or set its deadline
+func (d *Dialer) SearchQueryContext(ctx context.Context, query string) (uids []int, err error) {
+	if d.has(ctx, "X-GM-EXT-1") {
+		return d.SearchContext(ctx, NewSearch().GmailRaw(query))
+	}
+	criteria, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return d.SearchContext(ctx, criteria)
+}
+
+// GmailRaw matches messages using Gmail's own search syntax, this requires X-GM-EXT-1
+func (s *Search) GmailRaw(query string) *Search { return s.addString("X-GM-RAW", query) }
+
+// queryToken is a word, phrase or punctuation from a query
+type queryToken struct {
+	text string
+	// quoted is set when the token contains a quoted phrase, so it is never punctuation
+	quoted bool
+	// operator is set when the token has a : before any quoted phrase
+	operator bool
+}
+
+// tokenizeQuery splits a query into words, keeping quoted phrases together and
+// making ( ) { } and a leading - tokens of their own
+func tokenizeQuery(query string) []queryToken {
+	tokens := make([]queryToken, 0)
+	current := strings.Builder{}
+	quoted := false
+	operator := false
+	inQuote := false
+	flush := func() {
+		if current.Len() > 0 || quoted {
+			tokens = append(tokens, queryToken{text: current.String(), quoted: quoted, operator: operator})
+		}
+		current.Reset()
+		quoted = false
+		operator = false
+	}
+
+	for _, r := range query {
+		switch {
+		case inQuote:
+			if r == '"' {
+				inQuote = false
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"':
+			inQuote = true
+			quoted = true
+		case r == ' ' || r == '\t' || r == '\r' || r == '\n':
+			flush()
+		case r == '(' || r == ')' || r == '{' || r == '}':
+			flush()
+			tokens = append(tokens, queryToken{text: string(r)})
+		case r == '-' && current.Len() == 0 && !quoted:
+			tokens = append(tokens, queryToken{text: "-"})
+		case r == ':' && !quoted:
+			operator = true
+			current.WriteRune(r)
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// isPunct returns true if the next token is the unquoted text
+func (p *queryParser) isPunct(text string) bool {
+	t, ok := p.peek()
+	return ok && !t.quoted && t.text == text
+}
+
+// parseAll parses terms until the end of the query or a closing bracket, all of which must match
+func (p *queryParser) parseAll() (*Search, error) {
+	s := NewSearch()
+	for {
+		t, ok := p.peek()
+		if !ok || (!t.quoted && (t.text == ")" || t.text == "}")) {
+			break
+		}
+		if !t.quoted && t.text == "AND" {
+			p.pos++
+			continue
+		}
+		term, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		s.keys = append(s.keys, term.keys...)
+	}
+	if len(s.keys) == 0 {
+		return nil, fmt.Errorf("imap query: empty query")
+	}
+	return s, nil
+}
+
+// parseOr parses a term followed by any number of OR terms
+func (p *queryParser) parseOr() (*Search, error) {
+	s, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isPunct("OR") {
+		p.pos++
+		other, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		s = NewSearch().Or(s, other)
+	}
+	return s, nil
+}
+
+// parseUnary parses a negated term, a group or a single term
+func (p *queryParser) parseUnary() (*Search, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("imap query: unexpected end of query")
+	}
+	p.pos++
+	if t.quoted {
+		return p.parseTerm(t)
+	}
+
+	switch t.text {
+	case "-":
+		s, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return NewSearch().Not(s), nil
+	case "(":
+		s, err := p.parseAll()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isPunct(")") {
+			return nil, fmt.Errorf("imap query: missing )")
+		}
+		p.pos++
+		return s, nil
+	case "{":
+		var s *Search
+		for !p.isPunct("}") {
+			if _, ok := p.peek(); !ok {
+				return nil, fmt.Errorf("imap query: missing }")
+			}
+			term, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			if s == nil {
+				s = term
+			} else {
+				s = NewSearch().Or(s, term)
+			}
+		}
+		p.pos++
+		if s == nil {
+			return nil, fmt.Errorf("imap query: empty { }")
+		}
+		return s, nil
+	case ")", "}", "OR":
+		return nil, fmt.Errorf("imap query: unexpected %q", t.text)
+	}
+
+	return p.parseTerm(t)
+}
+
+// parseTerm parses a word, phrase or operator:value term
+func (p *queryParser) parseTerm(t queryToken) (*Search, error) {
+	s := NewSearch()
+	op, value, _ := strings.Cut(t.text, ":")
+	if !t.operator || op == "" {
+		return s.Text(t.text), nil
+	}
+	op = strings.ToLower(op)
+	if value == "" {
+		return nil, fmt.Errorf("imap query: missing value for %s:", op)
+	}
+
+	switch op {
+	case "from":
+		return s.From(value), nil
+	case "to":
+		return s.To(value), nil
+	case "cc":
+		return s.Cc(value), nil
+	case "bcc":
+		return s.Bcc(value), nil
+	case "subject":
+		return s.Subject(value), nil
+	case "list":
+		return s.Header("List-Id", value), nil
+	case "deliveredto":
+		return s.Header("Delivered-To", value), nil
+	case "rfc822msgid":
+		return s.Header("Message-ID", value), nil
+
+	case "after", "since", "before", "on":
+		date, err := parseQueryDate(value)
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "before":
+			return s.Before(date), nil
+		case "on":
+			return s.On(date), nil
+		}
+		return s.Since(date), nil
+
+	case "older_than", "newer_than":
+		date, err := parseQueryAge(value)
+		if err != nil {
+			return nil, err
+		}
+		if op == "older_than" {
+			return s.Before(date), nil
+		}
+		return s.Since(date), nil
+
+	case "larger", "size", "smaller":
+		size, err := parseQuerySize(value)
+		if err != nil {
+			return nil, err
+		}
+		if op == "smaller" {
+			return s.Smaller(size), nil
+		}
+		return s.Larger(size), nil
+
+	case "has":
+		if strings.ToLower(value) == "attachment" {
+			return s.Header("Content-Type", "multipart/mixed"), nil
+		}
+		return nil, fmt.Errorf("imap query: unsupported value has:%s", value)
+
+	case "is":
+		switch strings.ToLower(value) {
+		case "read":
+			return s.Flag(FlagSeen), nil
+		case "unread":
+			return s.NotFlag(FlagSeen), nil
+		case "starred", "flagged":
+			return s.Flag(FlagFlagged), nil
+		case "unstarred", "unflagged":
+			return s.NotFlag(FlagFlagged), nil
+		case "answered", "replied":
+			return s.Flag(FlagAnswered), nil
+		case "draft":
+			return s.Flag(FlagDraft), nil
+		case "deleted":
+			return s.Flag(FlagDeleted), nil
+		}
+		return nil, fmt.Errorf("imap query: unsupported value is:%s", value)
+	}
+
+	return nil, fmt.Errorf("imap query: unsupported operator %s:", op)
+}
+
+// parseQueryDate parses a date such as 2024/01/31 or 2024-1-31
+func parseQueryDate(value string) (time.Time, error) {
+	date, err := time.Parse("2006/1/2", strings.ReplaceAll(value, "-", "/"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("imap query: invalid date %q, use YYYY/MM/DD", value)
+	}
+	return date, nil
+}
+
+// parseQueryAge parses an age such as 3d, 2m or 1y and returns that long before now
+func parseQueryAge(value string) (time.Time, error) {
+	n, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || n < 0 {
+		return time.Time{}, fmt.Errorf("imap query: invalid age %q, use a number of d, m or y", value)
+	}
+	now := time.Now()
+	switch strings.ToLower(value[len(value)-1:]) {
+	case "d":
+		return now.AddDate(0, 0, -n), nil
+	case "m":
+		return now.AddDate(0, -n, 0), nil
+	case "y":
+		return now.AddDate(-n, 0, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("imap query: invalid age %q, use a number of d, m or y", value)
+}
+
+// parseQuerySize parses a size in bytes with an optional K, M or G suffix
+func parseQuerySize(value string) (int, error) {
+	multiplier := 1
+	number := value
+	switch strings.ToUpper(value[len(value)-1:]) {
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		number = value[:len(value)-1]
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("imap query: invalid size %q", value)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,97 @@
+package imap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query, search string
+	}{
+		{"hello", `TEXT "hello"`},
+		{"hello world", `TEXT "hello" TEXT "world"`},
+		{`"hello world"`, `TEXT "hello world"`},
+		{"from:alice@example.com", `FROM "alice@example.com"`},
+		{"FROM:alice", `FROM "alice"`},
+		{`subject:"invoice 42"`, `SUBJECT "invoice 42"`},
+		{`subject:"a\b"`, `SUBJECT "a\\b"`},
+		{"to:bob cc:carol bcc:dave", `TO "bob" CC "carol" BCC "dave"`},
+		{"list:dev.example.com", `HEADER "List-Id" "dev.example.com"`},
+		{"deliveredto:me@example.com", `HEADER "Delivered-To" "me@example.com"`},
+		{"rfc822msgid:<1@example.com>", `HEADER "Message-ID" "<1@example.com>"`},
+		{"after:2024/01/31", "SINCE 31-Jan-2024"},
+		{"since:2024-1-5", "SINCE 5-Jan-2024"},
+		{"before:2024/02/01", "BEFORE 1-Feb-2024"},
+		{"on:2024/02/29", "ON 29-Feb-2024"},
+		{"larger:10K", "LARGER 10240"},
+		{"size:2M", "LARGER 2097152"},
+		{"smaller:100", "SMALLER 100"},
+		{"has:attachment", `HEADER "Content-Type" "multipart/mixed"`},
+		{"is:unread", "UNSEEN"},
+		{"is:read is:starred", "SEEN FLAGGED"},
+		{"is:unstarred is:answered is:draft is:deleted", "UNFLAGGED ANSWERED DRAFT DELETED"},
+		{"-is:read", "NOT (SEEN)"},
+		{"-from:alice", `NOT (FROM "alice")`},
+		{"a-b", `TEXT "a-b"`},
+		{`"-x"`, `TEXT "-x"`},
+		{"from:alice OR from:bob", `OR (FROM "alice") (FROM "bob")`},
+		{"from:a OR from:b OR from:c", `OR (OR (FROM "a") (FROM "b")) (FROM "c")`},
+		{"from:a AND to:b", `FROM "a" TO "b"`},
+		{"{from:a from:b}", `OR (FROM "a") (FROM "b")`},
+		{"(from:a to:b) OR is:starred", `OR (FROM "a" TO "b") (FLAGGED)`},
+		{"-(from:a OR from:b) is:unread", `NOT (OR (FROM "a") (FROM "b")) UNSEEN`},
+		{`"OR"`, `TEXT "OR"`},
+	}
+	for _, tt := range tests {
+		s, err := ParseQuery(tt.query)
+		require.NoError(t, err, tt.query)
+		require.NoError(t, s.Err(), tt.query)
+		require.Equal(t, tt.search, s.String(), tt.query)
+	}
+
+	for _, query := range []string{
+		"",
+		"   ",
+		"from:",
+		"subject:(dinner movie)",
+		"label:work",
+		"has:drive",
+		"is:important",
+		"after:yesterday",
+		"after:2024/13/01",
+		"larger:big",
+		"smaller:-5",
+		"older_than:3w",
+		"older_than:d",
+		"(from:a",
+		"from:a)",
+		"{from:a",
+		"{}",
+		"()",
+		"OR from:a",
+		"from:a OR",
+		"-",
+	} {
+		_, err := ParseQuery(query)
+		require.Error(t, err, query)
+	}
+}
+
+func TestParseQueryUTF8(t *testing.T) {
+	s, err := ParseQuery("subject:café")
+	require.NoError(t, err)
+	require.Equal(t, "UID SEARCH CHARSET UTF-8 SUBJECT {5}\r\ncafé", searchCommand("UID SEARCH ", s).String())
+}
+
+func TestParseQueryAge(t *testing.T) {
+	s, err := ParseQuery("newer_than:2d")
+	require.NoError(t, err)
+	require.Equal(t, "SINCE "+time.Now().AddDate(0, 0, -2).Format(searchDateFormat), s.String())
+
+	s, err = ParseQuery("older_than:1y")
+	require.NoError(t, err)
+	require.Equal(t, "BEFORE "+time.Now().AddDate(-1, 0, 0).Format(searchDateFormat), s.String())
+}
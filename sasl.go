@@ -0,0 +1,250 @@
+package imap
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SASLMechanism is a SASL authentication mechanism used by Authenticate
+type SASLMechanism interface {
+	// Name returns the SASL name of the mechanism, e.g. PLAIN
+	Name() string
+	// Start begins authentication and returns the initial response,
+	// nil if the mechanism does not send one
+	Start() (ir []byte, err error)
+	// Next returns the response to a challenge sent by the server
+	Next(challenge []byte) (response []byte, err error)
+}
+
+// saslDoner is implemented by mechanisms which check the server once it accepts the
+// authentication, e.g. SCRAM which fails if the server never sent its signature
+type saslDoner interface {
+	Done() error
+}
+
+// AuthenticateError is returned by Authenticate when the server rejects the authentication
+type AuthenticateError struct {
+	// Mechanism is the name of the mechanism that was used
+	Mechanism string
+	// Response is the text of the server's tagged response
+	Response string
+	// Challenge is the last decoded challenge sent by the server, for XOAUTH2 and
+	// OAUTHBEARER this is a JSON object describing the failure
+	Challenge []byte
+}
+
+func (e *AuthenticateError) Error() string {
+	if len(e.Challenge) != 0 {
+		return fmt.Sprintf("imap authenticate %s failed: %s: %s", e.Mechanism, e.Response, e.Challenge)
+	}
+	return fmt.Sprintf("imap authenticate %s failed: %s", e.Mechanism, e.Response)
+}
+
+// authenticate logs in using Auth when it is set, otherwise with Username and Password using
+// the best mechanism the server offers; SCRAM-SHA-256 is preferred, and when the connection is
+// not using TLS or LOGIN is disabled CRAM-MD5 is preferred over LOGIN
+func (d *Dialer) authenticate() (err error) {
+	if d.Auth != nil {
+		return d.Authenticate(d.Auth)
+	}
+
+	capabilities, err := d.Capabilities()
+	if err != nil {
+		return
+	}
+
+	tlsConn, isTLS := d.conn.(*tls.Conn)
+	switch {
+	case isTLS && hasCapability(capabilities, "AUTH=SCRAM-SHA-256-PLUS"):
+		mech, err := ScramSHA256PlusAuth(d.Username, d.Password, tlsConn.ConnectionState())
+		if err != nil {
+			return err
+		}
+		return d.Authenticate(mech)
+	case hasCapability(capabilities, "AUTH=SCRAM-SHA-256"):
+		mech := &scramAuth{username: d.Username, password: d.Password, gs2: "n,,"}
+		if isTLS {
+			// We support channel binding but the server didn't offer it
+			mech.gs2 = "y,,"
+		}
+		return d.Authenticate(mech)
+	case (!isTLS || hasCapability(capabilities, "LOGINDISABLED")) && hasCapability(capabilities, "AUTH=CRAM-MD5"):
+		return d.Authenticate(CramMD5Auth(d.Username, d.Password))
+	case hasCapability(capabilities, "LOGINDISABLED") && isTLS && hasCapability(capabilities, "AUTH=PLAIN"):
+		return d.Authenticate(PlainAuth("", d.Username, d.Password))
+	}
+
+	return d.Login(d.Username, d.Password)
+}
+
+// Authenticate authenticates using the given SASL mechanism with the AUTHENTICATE command,
+// sending the initial response with the command when the server supports SASL-IR. When the
+// mechanism has a Done() error method it is called once the server accepts the authentication,
+// so a mechanism such as SCRAM can fail if the server didn't prove who it is
+func (d *Dialer) Authenticate(mech SASLMechanism) (err error) {
+	return d.AuthenticateContext(context.Background(), mech)
+}
+
+// AuthenticateContext is Authenticate with a context that can cancel the command or set its deadline
+func (d *Dialer) AuthenticateContext(ctx context.Context, mech SASLMechanism) (err error) {
+	capabilities, err := d.CapabilitiesContext(ctx)
+	if err != nil {
+		return
+	}
+
+	ir, err := mech.Start()
+	if err != nil {
+		return fmt.Errorf("imap authenticate %s: %s", mech.Name(), err)
+	}
+
+	command := "AUTHENTICATE " + mech.Name()
+	if ir != nil && hasCapability(capabilities, "SASL-IR") {
+		command += " " + encodeSASL(ir)
+		ir = nil
+	}
+
+	// Capabilities may change after authentication, the server normally sends them with its response
+	d.capabilities = nil
+
+	var challenge []byte
+	var mechErr error
+	_, _, err = d.exec(ctx, command, false, nil, func(line []byte) ([]byte, error) {
+		if ir != nil {
+			// The server sends an empty challenge when it wants the initial response
+			resp := ir
+			ir = nil
+			return []byte(base64.StdEncoding.EncodeToString(resp) + nl), nil
+		}
+
+		var err error
+		challenge, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(line[1:])))
+		if err != nil {
+			mechErr = fmt.Errorf("imap authenticate %s: invalid challenge: %s", mech.Name(), err)
+			return []byte("*" + nl), nil
+		}
+
+		resp, err := mech.Next(challenge)
+		if err != nil {
+			mechErr = fmt.Errorf("imap authenticate %s: %s", mech.Name(), err)
+			return []byte("*" + nl), nil
+		}
+		// An empty response is an empty line, "=" is only used for the initial response
+		return []byte(base64.StdEncoding.EncodeToString(resp) + nl), nil
+	})
+	if mechErr != nil {
+		return mechErr
+	}
+	if err != nil {
+		var cerr *CommandError
+		if errors.As(err, &cerr) {
+			return &AuthenticateError{
+				Mechanism: mech.Name(),
+				Response:  cerr.Text,
+				Challenge: challenge,
+			}
+		}
+		return err
+	}
+	if m, ok := mech.(saslDoner); ok {
+		if err = m.Done(); err != nil {
+			return fmt.Errorf("imap authenticate %s: %s", mech.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// encodeSASL encodes the initial response sent with the AUTHENTICATE command,
+// an empty initial response is sent as "=" (RFC 4959)
+func encodeSASL(b []byte) string {
+	if len(b) == 0 {
+		return "="
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+type plainAuth struct {
+	identity, username, password string
+}
+
+// PlainAuth returns a SASLMechanism implementing PLAIN (RFC 4616), identity is normally empty
+// to act as username. PLAIN sends the password so should only be used over TLS
+func PlainAuth(identity, username, password string) SASLMechanism {
+	return &plainAuth{identity, username, password}
+}
+
+func (a *plainAuth) Name() string {
+	return "PLAIN"
+}
+
+func (a *plainAuth) Start() ([]byte, error) {
+	return []byte(a.identity + "\x00" + a.username + "\x00" + a.password), nil
+}
+
+func (a *plainAuth) Next(challenge []byte) ([]byte, error) {
+	return nil, fmt.Errorf("unexpected server challenge")
+}
+
+type xoauth2Auth struct {
+	username, token string
+}
+
+// XOAuth2Auth returns a SASLMechanism implementing XOAUTH2 as used by Gmail and Microsoft 365,
+// token is an OAuth 2.0 access token
+func XOAuth2Auth(username, token string) SASLMechanism {
+	return &xoauth2Auth{username, token}
+}
+
+func (a *xoauth2Auth) Name() string {
+	return "XOAUTH2"
+}
+
+func (a *xoauth2Auth) Start() ([]byte, error) {
+	return []byte("user=" + a.username + "\x01auth=Bearer " + a.token + "\x01\x01"), nil
+}
+
+func (a *xoauth2Auth) Next(challenge []byte) ([]byte, error) {
+	// The challenge is a JSON error, an empty response is required before the server fails
+	return []byte{}, nil
+}
+
+type oauthBearerAuth struct {
+	username, token, host string
+	port                  int
+}
+
+// OAuthBearerAuth returns a SASLMechanism implementing OAUTHBEARER (RFC 7628),
+// token is an OAuth 2.0 access token and host and port are those of the server
+func OAuthBearerAuth(username, token, host string, port int) SASLMechanism {
+	return &oauthBearerAuth{username, token, host, port}
+}
+
+func (a *oauthBearerAuth) Name() string {
+	return "OAUTHBEARER"
+}
+
+func (a *oauthBearerAuth) Start() ([]byte, error) {
+	gs2 := "n,,"
+	if a.username != "" {
+		gs2 = "n,a=" + strings.NewReplacer("=", "=3D", ",", "=2C").Replace(a.username) + ","
+	}
+	ir := gs2 + "\x01"
+	if a.host != "" {
+		ir += "host=" + a.host + "\x01"
+	}
+	if a.port != 0 {
+		ir += "port=" + strconv.Itoa(a.port) + "\x01"
+	}
+	ir += "auth=Bearer " + a.token + "\x01\x01"
+	return []byte(ir), nil
+}
+
+func (a *oauthBearerAuth) Next(challenge []byte) ([]byte, error) {
+	// The challenge is a JSON error, the client must reply with a single ^A (RFC 7628 3.2.3)
+	return []byte{0x01}, nil
+}
@@ -0,0 +1,144 @@
+package imap
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// scramServer answers a SCRAM-SHA-256 AUTHENTICATE for the password, sending its signature
+// before the tagged OK when sendSignature is set. It returns the client's final reply, if any
+func scramServer(server net.Conn, password string, sendSignature bool) (reply string, err error) {
+	r := bufio.NewReader(server)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return
+	}
+	fields := strings.Fields(line)
+	if len(fields) != 4 || fields[1] != "AUTHENTICATE" || fields[2] != "SCRAM-SHA-256" {
+		return "", errors.New("unexpected command " + line)
+	}
+	tag := fields[0]
+	ir, err := base64.StdEncoding.DecodeString(fields[3])
+	if err != nil {
+		return
+	}
+	clientFirst := strings.TrimPrefix(string(ir), "n,,")
+
+	salt := []byte("salt")
+	serverFirst := "r=" + scramAttributes(clientFirst)["r"] + "server,s=" + base64.StdEncoding.EncodeToString(salt) + ",i=1"
+	if _, err = fmt.Fprintf(server, "+ %s\r\n", base64.StdEncoding.EncodeToString([]byte(serverFirst))); err != nil {
+		return
+	}
+
+	if line, err = r.ReadString('\n'); err != nil {
+		return
+	}
+	clientFinal, err := base64.StdEncoding.DecodeString(strings.TrimSpace(line))
+	if err != nil {
+		return
+	}
+	withoutProof := string(clientFinal[:strings.Index(string(clientFinal), ",p=")])
+
+	if sendSignature {
+		authMessage := clientFirst + "," + serverFirst + "," + withoutProof
+		serverKey := hmacSHA256(pbkdf2SHA256([]byte(password), salt, 1), []byte("Server Key"))
+		serverFinal := "v=" + base64.StdEncoding.EncodeToString(hmacSHA256(serverKey, []byte(authMessage)))
+		if _, err = fmt.Fprintf(server, "+ %s\r\n", base64.StdEncoding.EncodeToString([]byte(serverFinal))); err != nil {
+			return
+		}
+		if reply, err = r.ReadString('\n'); err != nil {
+			return
+		}
+	}
+
+	_, err = fmt.Fprintf(server, "%s OK authenticated\r\n", tag)
+	return
+}
+
+func TestScramServerSignature(t *testing.T) {
+	for _, sendSignature := range []bool{true, false} {
+		d, server := newPipeDialer(t)
+		d.capabilities = []string{"IMAP4rev1", "SASL-IR", "AUTH=SCRAM-SHA-256"}
+
+		serverErr := make(chan error, 1)
+		var reply string
+		go func() {
+			var err error
+			reply, err = scramServer(server, "pencil", sendSignature)
+			serverErr <- err
+		}()
+
+		err := d.Authenticate(ScramSHA256Auth("user", "pencil"))
+		require.NoError(t, <-serverErr)
+		if sendSignature {
+			require.NoError(t, err)
+			// An empty continuation reply is an empty line, not "="
+			require.Equal(t, "\r\n", reply)
+		} else {
+			require.EqualError(t, err, "imap authenticate SCRAM-SHA-256: server did not send its signature")
+		}
+	}
+}
+
+func TestScramSHA256(t *testing.T) {
+	// The example exchange from RFC 7677 section 3
+	a := &scramAuth{username: "user", password: "pencil", gs2: "n,,"}
+	_, err := a.Start()
+	require.NoError(t, err)
+	a.clientNonce = "rOprNGfwEbeRWgbNEkqO"
+	a.clientFirst = "n=user,r=rOprNGfwEbeRWgbNEkqO"
+
+	clientFinal, err := a.Next([]byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"))
+	require.NoError(t, err)
+	require.Equal(t, "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=", string(clientFinal))
+	require.Error(t, a.Done())
+
+	_, err = a.Next([]byte("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="))
+	require.NoError(t, err)
+	require.NoError(t, a.Done())
+}
+
+func TestXOAuth2Error(t *testing.T) {
+	d, server := newPipeDialer(t)
+	d.capabilities = []string{"IMAP4rev1", "SASL-IR", "AUTH=XOAUTH2"}
+
+	challenge := `{"status":"401","schemes":"bearer","scope":"https://mail.google.com/"}`
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- func() error {
+			r := bufio.NewReader(server)
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return err
+			}
+			tag := strings.Fields(line)[0]
+			if _, err = fmt.Fprintf(server, "+ %s\r\n", base64.StdEncoding.EncodeToString([]byte(challenge))); err != nil {
+				return err
+			}
+			if line, err = r.ReadString('\n'); err != nil {
+				return err
+			}
+			if line != "\r\n" {
+				_, err = fmt.Fprintf(server, "%s BAD invalid response\r\n", tag)
+				return err
+			}
+			_, err = fmt.Fprintf(server, "%s NO [AUTHENTICATIONFAILED] Invalid credentials\r\n", tag)
+			return err
+		}()
+	}()
+
+	err := d.Authenticate(XOAuth2Auth("user@example.com", "token"))
+	require.NoError(t, <-serverErr)
+	var authErr *AuthenticateError
+	require.ErrorAs(t, err, &authErr)
+	require.Equal(t, "XOAUTH2", authErr.Mechanism)
+	require.Contains(t, authErr.Response, "Invalid credentials")
+	require.Equal(t, challenge, string(authErr.Challenge))
+}
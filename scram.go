@@ -0,0 +1,237 @@
+package imap
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+type scramAuth struct {
+	username string
+	password string
+	// gs2 is the GS2 header which says whether channel binding is used
+	gs2 string
+	// cbData is the channel binding data when channel binding is used
+	cbData []byte
+	plus   bool
+
+	step        int
+	clientNonce string
+	clientFirst string
+	authMessage string
+	saltedPass  []byte
+	// verified is set once the server's signature has been checked
+	verified bool
+}
+
+// ScramSHA256Auth returns a SASLMechanism implementing SCRAM-SHA-256 (RFC 7677)
+// without channel binding
+func ScramSHA256Auth(username, password string) SASLMechanism {
+	return &scramAuth{username: username, password: password, gs2: "n,,"}
+}
+
+// ScramSHA256PlusAuth returns a SASLMechanism implementing SCRAM-SHA-256-PLUS, which binds the
+// authentication to the TLS connection with the given state using tls-server-end-point (RFC 5929)
+func ScramSHA256PlusAuth(username, password string, state tls.ConnectionState) (SASLMechanism, error) {
+	cbData, err := tlsServerEndPoint(state)
+	if err != nil {
+		return nil, err
+	}
+	return &scramAuth{
+		username: username,
+		password: password,
+		gs2:      "p=tls-server-end-point,,",
+		cbData:   cbData,
+		plus:     true,
+	}, nil
+}
+
+// tlsServerEndPoint returns the tls-server-end-point channel binding data, which is the hash
+// of the server certificate using the hash from its signature algorithm, or SHA-256 when
+// that is MD5 or SHA-1
+func tlsServerEndPoint(state tls.ConnectionState) ([]byte, error) {
+	if len(state.PeerCertificates) == 0 {
+		return nil, fmt.Errorf("tls-server-end-point: no server certificate")
+	}
+	cert := state.PeerCertificates[0]
+
+	var h hash.Hash
+	switch cert.SignatureAlgorithm {
+	case x509.SHA384WithRSA, x509.ECDSAWithSHA384, x509.SHA384WithRSAPSS:
+		h = sha512.New384()
+	case x509.SHA512WithRSA, x509.ECDSAWithSHA512, x509.SHA512WithRSAPSS:
+		h = sha512.New()
+	case x509.PureEd25519, x509.UnknownSignatureAlgorithm:
+		return nil, fmt.Errorf("tls-server-end-point: unsupported certificate signature algorithm %s", cert.SignatureAlgorithm)
+	default:
+		h = sha256.New()
+	}
+	h.Write(cert.Raw)
+	return h.Sum(nil), nil
+}
+
+func (a *scramAuth) Name() string {
+	if a.plus {
+		return "SCRAM-SHA-256-PLUS"
+	}
+	return "SCRAM-SHA-256"
+}
+
+func (a *scramAuth) Start() ([]byte, error) {
+	nonce := make([]byte, 18)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	a.step = 0
+	a.verified = false
+	a.clientNonce = base64.RawStdEncoding.EncodeToString(nonce)
+	a.clientFirst = "n=" + scramEscape(a.username) + ",r=" + a.clientNonce
+	return []byte(a.gs2 + a.clientFirst), nil
+}
+
+func (a *scramAuth) Next(challenge []byte) ([]byte, error) {
+	a.step++
+	switch a.step {
+	case 1:
+		return a.clientFinal(string(challenge))
+	case 2:
+		if err := a.verifyServerFinal(string(challenge)); err != nil {
+			return nil, err
+		}
+		a.verified = true
+		return []byte{}, nil
+	}
+	return nil, fmt.Errorf("unexpected server challenge")
+}
+
+// Done fails unless the server proved it knows the password, a server which accepts the
+// authentication without sending its signature can't be trusted (RFC 5802 section 5)
+func (a *scramAuth) Done() error {
+	if !a.verified {
+		return fmt.Errorf("server did not send its signature")
+	}
+	return nil
+}
+
+// clientFinal returns the client-final-message for the server-first-message
+func (a *scramAuth) clientFinal(serverFirst string) ([]byte, error) {
+	attrs := scramAttributes(serverFirst)
+	if e, ok := attrs["e"]; ok {
+		return nil, fmt.Errorf("server error: %s", e)
+	}
+	nonce := attrs["r"]
+	if !strings.HasPrefix(nonce, a.clientNonce) || len(nonce) == len(a.clientNonce) {
+		return nil, fmt.Errorf("invalid server nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil || len(salt) == 0 {
+		return nil, fmt.Errorf("invalid salt")
+	}
+	iterations, err := strconv.Atoi(attrs["i"])
+	if err != nil || iterations < 1 {
+		return nil, fmt.Errorf("invalid iteration count")
+	}
+
+	a.saltedPass = pbkdf2SHA256([]byte(a.password), salt, iterations)
+	clientKey := hmacSHA256(a.saltedPass, []byte("Client Key"))
+	storedKey := sha256.Sum256(clientKey)
+
+	cbind := base64.StdEncoding.EncodeToString(append([]byte(a.gs2), a.cbData...))
+	withoutProof := "c=" + cbind + ",r=" + nonce
+	a.authMessage = a.clientFirst + "," + serverFirst + "," + withoutProof
+
+	proof := hmacSHA256(storedKey[:], []byte(a.authMessage))
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+
+	return []byte(withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+}
+
+// verifyServerFinal checks the server-final-message proves the server knows the password
+func (a *scramAuth) verifyServerFinal(serverFinal string) error {
+	attrs := scramAttributes(serverFinal)
+	if e, ok := attrs["e"]; ok {
+		return fmt.Errorf("server error: %s", e)
+	}
+	verifier, err := base64.StdEncoding.DecodeString(attrs["v"])
+	if err != nil {
+		return fmt.Errorf("invalid server signature")
+	}
+	serverKey := hmacSHA256(a.saltedPass, []byte("Server Key"))
+	if !hmac.Equal(verifier, hmacSHA256(serverKey, []byte(a.authMessage))) {
+		return fmt.Errorf("server signature does not match")
+	}
+	return nil
+}
+
+// scramAttributes splits a SCRAM message into its attributes
+func scramAttributes(msg string) map[string]string {
+	attrs := make(map[string]string)
+	for _, a := range strings.Split(msg, ",") {
+		if len(a) >= 2 && a[1] == '=' {
+			attrs[a[:1]] = a[2:]
+		}
+	}
+	return attrs
+}
+
+var scramEscape = strings.NewReplacer("=", "=3D", ",", "=2C").Replace
+
+func hmacSHA256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// pbkdf2SHA256 is PBKDF2 (RFC 8018) with HMAC-SHA-256 producing a single block,
+// which is the Hi() function used by SCRAM-SHA-256
+func pbkdf2SHA256(password, salt []byte, iterations int) []byte {
+	prf := hmac.New(sha256.New, password)
+	prf.Write(salt)
+	prf.Write([]byte{0, 0, 0, 1})
+	u := prf.Sum(nil)
+	result := make([]byte, len(u))
+	copy(result, u)
+	for n := 1; n < iterations; n++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for i := range result {
+			result[i] ^= u[i]
+		}
+	}
+	return result
+}
+
+type cramMD5Auth struct {
+	username, password string
+}
+
+// CramMD5Auth returns a SASLMechanism implementing CRAM-MD5 (RFC 2195)
+func CramMD5Auth(username, password string) SASLMechanism {
+	return &cramMD5Auth{username, password}
+}
+
+func (a *cramMD5Auth) Name() string {
+	return "CRAM-MD5"
+}
+
+func (a *cramMD5Auth) Start() ([]byte, error) {
+	return nil, nil
+}
+
+func (a *cramMD5Auth) Next(challenge []byte) ([]byte, error) {
+	h := hmac.New(md5.New, []byte(a.password))
+	h.Write(challenge)
+	return []byte(fmt.Sprintf("%s %x", a.username, h.Sum(nil))), nil
+}
@@ -0,0 +1,302 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchDateFormat is the format of dates in SEARCH criteria
+const searchDateFormat = "2-Jan-2006"
+
+// Search is a set of search criteria for Dialer.Search, all of which must match. It is built by
+// chaining its methods, strings are quoted or sent as literals as needed so user input is safe
+// to use, e.g.
+//
+//	imap.NewSearch().From("alice@example.com").Subject(`invoice "42"`).NotFlag(imap.FlagSeen)
+type Search struct {
+	keys []searchKey
+	// err is the first invalid criteria added, which is left out of the search
+	err error
+}
+
+// searchKey is a single part of a search, either an atom, a string or a group of keys
+type searchKey struct {
+	atom     string
+	str      string
+	isString bool
+	group    *Search
+}
+
+// NewSearch returns an empty Search, which matches all messages
+func NewSearch() *Search {
+	return &Search{keys: make([]searchKey, 0)}
+}
+
+func (s *Search) add(atoms ...string) *Search {
+	for _, a := range atoms {
+		s.keys = append(s.keys, searchKey{atom: a})
+	}
+	return s
+}
+
+func (s *Search) addString(atom string, str string) *Search {
+	s.keys = append(s.keys, searchKey{atom: atom}, searchKey{str: str, isString: true})
+	return s
+}
+
+func (s *Search) addGroup(g *Search) *Search {
+	if g == nil {
+		g = NewSearch()
+	}
+	if len(g.keys) == 0 {
+		g = &Search{keys: []searchKey{{atom: "ALL"}}, err: g.err}
+	}
+	s.keys = append(s.keys, searchKey{group: g})
+	return s
+}
+
+// All matches all messages
+func (s *Search) All() *Search { return s.add("ALL") }
+
+// From matches messages with the string in the From header
+func (s *Search) From(str string) *Search { return s.addString("FROM", str) }
+
+// To matches messages with the string in the To header
+func (s *Search) To(str string) *Search { return s.addString("TO", str) }
+
+// Cc matches messages with the string in the Cc header
+func (s *Search) Cc(str string) *Search { return s.addString("CC", str) }
+
+// Bcc matches messages with the string in the Bcc header
+func (s *Search) Bcc(str string) *Search { return s.addString("BCC", str) }
+
+// Subject matches messages with the string in the Subject header
+func (s *Search) Subject(str string) *Search { return s.addString("SUBJECT", str) }
+
+// Body matches messages with the string in the body
+func (s *Search) Body(str string) *Search { return s.addString("BODY", str) }
+
+// Text matches messages with the string in the headers or body
+func (s *Search) Text(str string) *Search { return s.addString("TEXT", str) }
+
+// Header matches messages with the string in the named header,
+// an empty string matches all messages with the header
+func (s *Search) Header(name string, str string) *Search {
+	s.addString("HEADER", name)
+	s.keys = append(s.keys, searchKey{str: str, isString: true})
+	return s
+}
+
+// Since matches messages received on or after the date of t
+func (s *Search) Since(t time.Time) *Search { return s.add("SINCE", t.Format(searchDateFormat)) }
+
+// Before matches messages received before the date of t
+func (s *Search) Before(t time.Time) *Search { return s.add("BEFORE", t.Format(searchDateFormat)) }
+
+// On matches messages received on the date of t
+func (s *Search) On(t time.Time) *Search { return s.add("ON", t.Format(searchDateFormat)) }
+
+// SentSince matches messages with a Date header on or after the date of t
+func (s *Search) SentSince(t time.Time) *Search {
+	return s.add("SENTSINCE", t.Format(searchDateFormat))
+}
+
+// SentBefore matches messages with a Date header before the date of t
+func (s *Search) SentBefore(t time.Time) *Search {
+	return s.add("SENTBEFORE", t.Format(searchDateFormat))
+}
+
+// SentOn matches messages with a Date header on the date of t
+func (s *Search) SentOn(t time.Time) *Search { return s.add("SENTON", t.Format(searchDateFormat)) }
+
+// Larger matches messages larger than size bytes
+func (s *Search) Larger(size int) *Search { return s.add("LARGER", strconv.Itoa(size)) }
+
+// Smaller matches messages smaller than size bytes
+func (s *Search) Smaller(size int) *Search { return s.add("SMALLER", strconv.Itoa(size)) }
+
+// Flag matches messages with the flag, either a system flag such as FlagSeen or a keyword.
+// An invalid keyword is left out and its error is returned by Err and when the search is run
+func (s *Search) Flag(flag string) *Search {
+	switch strings.ToLower(flag) {
+	case `\seen`, `\answered`, `\flagged`, `\deleted`, `\draft`, `\recent`:
+		return s.add(strings.ToUpper(flag[1:]))
+	}
+	return s.addKeyword("KEYWORD", flag)
+}
+
+// NotFlag matches messages without the flag, either a system flag such as FlagSeen or a keyword.
+// An invalid keyword is left out and its error is returned by Err and when the search is run
+func (s *Search) NotFlag(flag string) *Search {
+	switch strings.ToLower(flag) {
+	case `\seen`, `\answered`, `\flagged`, `\deleted`, `\draft`:
+		return s.add("UN" + strings.ToUpper(flag[1:]))
+	case `\recent`:
+		return s.add("OLD")
+	}
+	return s.addKeyword("UNKEYWORD", flag)
+}
+
+// addKeyword adds a KEYWORD or UNKEYWORD key, keywords are sent as atoms so they are checked first
+func (s *Search) addKeyword(atom string, keyword string) *Search {
+	if strings.HasPrefix(keyword, `\`) || !IsValidFlag(keyword) {
+		if s.err == nil {
+			s.err = fmt.Errorf("imap search: invalid keyword %q", keyword)
+		}
+		return s
+	}
+	return s.add(atom, keyword)
+}
+
+// UID matches the messages with the given UIDs
+func (s *Search) UID(uids ...int) *Search {
+	return s.UIDSet(NewUIDSet(uids...))
+}
+
+// UIDSet matches the messages with UIDs in the set
+func (s *Search) UIDSet(set UIDSet) *Search {
+	if set.Empty() {
+		// An empty set isn't valid, so match nothing instead
+		return s.add("NOT", "ALL")
+	}
+	return s.add("UID", set.String())
+}
+
+// Seq matches the messages with sequence numbers in the set
+func (s *Search) Seq(set SeqSet) *Search {
+	if set.Empty() {
+		return s.add("NOT", "ALL")
+	}
+	return s.add(set.String())
+}
+
+// And matches messages matching all the searches
+func (s *Search) And(searches ...*Search) *Search {
+	for _, g := range searches {
+		s.addGroup(g)
+	}
+	return s
+}
+
+// Or matches messages matching either search
+func (s *Search) Or(a *Search, b *Search) *Search {
+	s.add("OR")
+	s.addGroup(a)
+	return s.addGroup(b)
+}
+
+// Not matches messages that do not match the search
+func (s *Search) Not(search *Search) *Search {
+	s.add("NOT")
+	return s.addGroup(search)
+}
+
+// Err returns the first invalid criteria added to the search or the searches it contains, if any
+func (s *Search) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	for _, k := range s.keys {
+		if k.group != nil {
+			if err := k.group.Err(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Search) build(b *commandBuilder) {
+	if len(s.keys) == 0 {
+		b.atom("ALL")
+		return
+	}
+	for i, k := range s.keys {
+		if i != 0 {
+			b.atom(" ")
+		}
+		switch {
+		case k.group != nil:
+			b.atom("(")
+			k.group.build(b)
+			b.atom(")")
+		case k.isString:
+			b.str(k.str)
+		default:
+			b.atom(k.atom)
+		}
+	}
+}
+
+// String returns the search as it is sent to the server
+func (s *Search) String() string {
+	b := &commandBuilder{}
+	s.build(b)
+	return b.String()
+}
+
+// Search returns the UIDs in the current folder that match the criteria,
+// CHARSET UTF-8 is sent when the criteria contains non ASCII characters
+func (d *Dialer) Search(criteria *Search) (uids []int, err error) {
+	return d.SearchContext(context.Background(), criteria)
+}
+
+// SearchContext is Search with a context that can cancel the command or set its deadline
+func (d *Dialer) SearchContext(ctx context.Context, criteria *Search) (uids []int, err error) {
+	if criteria == nil {
+		criteria = NewSearch()
+	}
+	if err = criteria.Err(); err != nil {
+		return nil, err
+	}
+	return d.searchUIDs(ctx, searchCommand("UID SEARCH ", criteria), "SEARCH")
+}
+
+// searchCommand builds command followed by criteria, adding CHARSET UTF-8 when the criteria
+// contains non ASCII characters
+func searchCommand(command string, criteria *Search) *commandBuilder {
+	// The charset has to come first, so the criteria is built once to find if it is needed
+	probe := &commandBuilder{}
+	criteria.build(probe)
+	b := &commandBuilder{}
+	b.atom(command)
+	if probe.utf8 {
+		b.atom("CHARSET UTF-8 ")
+	}
+	criteria.build(b)
+	return b
+}
+
+// searchUIDs executes the command and returns the numbers from its untagged responses
+// of the given type, e.g. SEARCH or SORT
+func (d *Dialer) searchUIDs(ctx context.Context, b *commandBuilder, response string) (uids []int, err error) {
+	prefix := []byte("* " + response)
+	uids = make([]int, 0)
+	_, _, err = d.execBuilt(ctx, b, false, func(line []byte) (err error) {
+		line = dropNl(line)
+		if !bytes.HasPrefix(line, prefix) {
+			return
+		}
+		for _, f := range strings.Fields(string(line[len(prefix):])) {
+			if strings.HasPrefix(f, "(") {
+				// e.g. (MODSEQ 123) from CONDSTORE (RFC 7162)
+				break
+			}
+			u, err := strconv.Atoi(f)
+			if err != nil {
+				return err
+			}
+			uids = append(uids, u)
+		}
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return uids, nil
+}
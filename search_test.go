@@ -0,0 +1,34 @@
+package imap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchFlags(t *testing.T) {
+	s := NewSearch().Flag(FlagSeen).NotFlag(`\Recent`).Flag("$Label1").NotFlag("Work")
+	require.NoError(t, s.Err())
+	require.Equal(t, "SEEN OLD KEYWORD $Label1 UNKEYWORD Work", s.String())
+
+	for _, keyword := range []string{"", "a) OR (ALL", `\Custom`, "two words", `a"b`, "café"} {
+		s := NewSearch().NotFlag(keyword)
+		require.Error(t, s.Err(), keyword)
+		require.Equal(t, "ALL", s.String(), keyword)
+
+		s = NewSearch().Not(NewSearch().Flag(keyword))
+		require.Error(t, s.Err(), keyword)
+		require.Equal(t, "NOT (ALL)", s.String(), keyword)
+	}
+}
+
+func TestSearchUIDs(t *testing.T) {
+	require.Equal(t, "UID 1:3,7", NewSearch().UID(3, 1, 2, 7).String())
+	require.Equal(t, "NOT ALL", NewSearch().UID().String())
+	require.Equal(t, "NOT ALL", NewSearch().UID(0, -1).String())
+	set, err := ParseUIDSet("500:*")
+	require.NoError(t, err)
+	require.Equal(t, "UID 500:*", NewSearch().UIDSet(set).String())
+	require.Equal(t, "NOT ALL", NewSearch().UIDSet(UIDSet{}).String())
+	require.Equal(t, "1:10", NewSearch().Seq(NewSeqSet(1, 2, 3, 4, 5, 6, 7, 8, 9, 10)).String())
+}
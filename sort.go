@@ -0,0 +1,206 @@
+package imap
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Sort keys for SortUIDs (RFC 5256)
+const (
+	// SortArrival sorts by the date and time the message was received
+	SortArrival = "ARRIVAL"
+	// SortCc sorts by the first Cc address
+	SortCc = "CC"
+	// SortDate sorts by the Date header
+	SortDate = "DATE"
+	// SortFrom sorts by the first From address
+	SortFrom = "FROM"
+	// SortSize sorts by the size of the message
+	SortSize = "SIZE"
+	// SortSubject sorts by the base subject, without Re: etc.
+	SortSubject = "SUBJECT"
+	// SortTo sorts by the first To address
+	SortTo = "TO"
+)
+
+// SortCriterion is a sort key, e.g. SortDate, and whether to reverse its order
+type SortCriterion struct {
+	Key     string
+	Reverse bool
+}
+
+// Threading algorithms for Thread (RFC 5256)
+const (
+	// ThreadOrderedSubject groups messages by base subject, ordered by date
+	ThreadOrderedSubject = "ORDEREDSUBJECT"
+	// ThreadReferences groups messages using their In-Reply-To and References headers
+	ThreadReferences = "REFERENCES"
+)
+
+// Thread is a message in a thread returned by Dialer.Thread and its replies
+type Thread struct {
+	// UID is the UID of the message, or 0 when the message is missing but
+	// is known to be the parent of its children
+	UID      int
+	Children []*Thread
+}
+
+// SortUIDs returns the UIDs in the current folder that match the search sorted by the server
+// using SORT (RFC 5256), by each criterion in turn. A nil search matches all messages
+func (d *Dialer) SortUIDs(criteria []SortCriterion, search *Search) (uids []int, err error) {
+	return d.SortUIDsContext(context.Background(), criteria, search)
+}
+
+// SortUIDsContext is SortUIDs with a context that can cancel the command or set its deadline
+func (d *Dialer) SortUIDsContext(ctx context.Context, criteria []SortCriterion, search *Search) (uids []int, err error) {
+	if !d.has(ctx, "SORT") {
+		return nil, fmt.Errorf("imap sort: server does not support SORT")
+	}
+	if len(criteria) == 0 {
+		return nil, fmt.Errorf("imap sort: no sort criteria given")
+	}
+	if search == nil {
+		search = NewSearch()
+	}
+	if err = search.Err(); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(criteria)*2)
+	for _, c := range criteria {
+		if c.Key == "" || strings.ContainsAny(c.Key, " ()") {
+			return nil, fmt.Errorf("imap sort: invalid sort key %q", c.Key)
+		}
+		if c.Reverse {
+			keys = append(keys, "REVERSE")
+		}
+		keys = append(keys, strings.ToUpper(c.Key))
+	}
+
+	b := &commandBuilder{}
+	b.atom("UID SORT (" + strings.Join(keys, " ") + ") UTF-8 ")
+	search.build(b)
+	return d.searchUIDs(ctx, b, "SORT")
+}
+
+// Thread returns the messages in the current folder that match the search grouped into threads
+// by the server using THREAD (RFC 5256) with the algorithm, e.g. ThreadReferences, which the server
+// must support. A nil search matches all messages
+func (d *Dialer) Thread(algorithm string, search *Search) (threads []*Thread, err error) {
+	return d.ThreadContext(context.Background(), algorithm, search)
+}
+
+// ThreadContext is Thread with a context that can cancel the command or set its deadline
+func (d *Dialer) ThreadContext(ctx context.Context, algorithm string, search *Search) (threads []*Thread, err error) {
+	algorithm = strings.ToUpper(algorithm)
+	if algorithm == "" || strings.ContainsAny(algorithm, " ()") {
+		return nil, fmt.Errorf("imap thread: invalid algorithm %q", algorithm)
+	}
+	if !d.has(ctx, "THREAD="+algorithm) {
+		return nil, fmt.Errorf("imap thread: server does not support THREAD=%s", algorithm)
+	}
+	if search == nil {
+		search = NewSearch()
+	}
+	if err = search.Err(); err != nil {
+		return nil, err
+	}
+
+	b := &commandBuilder{}
+	b.atom("UID THREAD " + algorithm + " UTF-8 ")
+	search.build(b)
+
+	threads = make([]*Thread, 0)
+	_, _, err = d.execBuilt(ctx, b, false, func(line []byte) (err error) {
+		l := string(dropNl(line))
+		if !strings.HasPrefix(l, "* THREAD") {
+			return
+		}
+		t, err := parseThreads(l[len("* THREAD"):])
+		if err != nil {
+			return err
+		}
+		threads = append(threads, t...)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return threads, nil
+}
+
+// parseThreads parses the thread lists of a THREAD response, e.g. "(2)(3 6 (4 23)(44 7 96))"
+func parseThreads(s string) (threads []*Thread, err error) {
+	threads = make([]*Thread, 0)
+	i := 0
+	for {
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		if i >= len(s) {
+			return threads, nil
+		}
+		if s[i] != '(' {
+			return nil, fmt.Errorf("imap thread: invalid response %q", s)
+		}
+		t, err := parseThread(s, &i)
+		if err != nil {
+			return nil, err
+		}
+		threads = append(threads, t)
+	}
+}
+
+// parseThread parses the thread list starting at s[*i], which is a "(". Each UID in the list is
+// a reply to the one before, and any nested lists are replies to the last UID
+func parseThread(s string, i *int) (*Thread, error) {
+	var root, last *Thread
+	*i++
+	for {
+		if *i >= len(s) {
+			return nil, fmt.Errorf("imap thread: unterminated thread in %q", s)
+		}
+		switch c := s[*i]; {
+		case c == ' ':
+			*i++
+		case c == ')':
+			*i++
+			if root == nil {
+				return nil, fmt.Errorf("imap thread: empty thread in %q", s)
+			}
+			return root, nil
+		case c == '(':
+			child, err := parseThread(s, i)
+			if err != nil {
+				return nil, err
+			}
+			if last == nil {
+				// Siblings without a parent message
+				root = &Thread{}
+				last = root
+			}
+			last.Children = append(last.Children, child)
+		case c >= '0' && c <= '9':
+			start := *i
+			for *i < len(s) && s[*i] >= '0' && s[*i] <= '9' {
+				*i++
+			}
+			uid, err := strconv.Atoi(s[start:*i])
+			if err != nil {
+				return nil, fmt.Errorf("imap thread: invalid UID in %q", s)
+			}
+			t := &Thread{UID: uid}
+			if last == nil {
+				root = t
+			} else {
+				last.Children = append(last.Children, t)
+			}
+			last = t
+		default:
+			return nil, fmt.Errorf("imap thread: invalid response %q", s)
+		}
+	}
+}
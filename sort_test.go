@@ -0,0 +1,56 @@
+package imap
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// threadString formats a thread as its UID followed by its children in brackets, e.g. 3(6(4 44))
+func threadString(t *Thread) string {
+	s := strconv.Itoa(t.UID)
+	if len(t.Children) != 0 {
+		children := make([]string, len(t.Children))
+		for i, c := range t.Children {
+			children[i] = threadString(c)
+		}
+		s += "(" + strings.Join(children, " ") + ")"
+	}
+	return s
+}
+
+func TestParseThreads(t *testing.T) {
+	tests := []struct {
+		response string
+		threads  []string
+	}{
+		{"", []string{}},
+		{" ", []string{}},
+		{"(1)", []string{"1"}},
+		{"(1)(2)(3)", []string{"1", "2", "3"}},
+		{" (1) (2)", []string{"1", "2"}},
+		{"(1 2 3)", []string{"1(2(3))"}},
+		// The examples from RFC 5256 section 4
+		{"(2)(3 6 (4 23)(44 7 96))", []string{"2", "3(6(4(23) 44(7(96))))"}},
+		{"((3)(5))", []string{"0(3 5)"}},
+		{"(1 (2)(3 (4)(5)))", []string{"1(2 3(4 5))"}},
+		{"(166)(167)(168 (169)(170))", []string{"166", "167", "168(169 170)"}},
+		{"((1 2)(3)) (4)", []string{"0(1(2) 3)", "4"}},
+	}
+	for _, tt := range tests {
+		threads, err := parseThreads(tt.response)
+		require.NoError(t, err, tt.response)
+		got := make([]string, len(threads))
+		for i, th := range threads {
+			got[i] = threadString(th)
+		}
+		require.Equal(t, tt.threads, got, tt.response)
+	}
+
+	for _, response := range []string{"1", "(", "(1", "(1 (2)", "()", "(1)x", "(1 a)", "(1 -2)", ")"} {
+		_, err := parseThreads(response)
+		require.Error(t, err, response)
+	}
+}
@@ -0,0 +1,173 @@
+package imap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Special use folder attributes (RFC 6154)
+const (
+	// AttrAll is a virtual folder containing all messages, e.g. Gmail's All Mail
+	AttrAll = `\All`
+	// AttrArchive is used to archive messages
+	AttrArchive = `\Archive`
+	// AttrDrafts is used to hold draft messages
+	AttrDrafts = `\Drafts`
+	// AttrFlagged is a virtual folder containing all flagged messages
+	AttrFlagged = `\Flagged`
+	// AttrJunk is where junk mail (spam) is kept
+	AttrJunk = `\Junk`
+	// AttrSent is where copies of sent messages are kept
+	AttrSent = `\Sent`
+	// AttrTrash is where deleted messages are kept
+	AttrTrash = `\Trash`
+)
+
+// SpecialUseAttributes are the special use attributes in the order SpecialFolders checks them
+var SpecialUseAttributes = []string{AttrAll, AttrArchive, AttrDrafts, AttrFlagged, AttrJunk, AttrSent, AttrTrash}
+
+// specialUseNames are the well known names of special use folders for servers that don't
+// support SPECIAL-USE, in order of preference. Names are also matched below INBOX, e.g. INBOX.Sent
+var specialUseNames = map[string][]string{
+	AttrAll: {
+		"[Gmail]/All Mail", "[Google Mail]/All Mail", "All Mail",
+	},
+	AttrArchive: {
+		"Archive", "Archives", "Archiv",
+	},
+	AttrDrafts: {
+		"Drafts", "[Gmail]/Drafts", "[Google Mail]/Drafts", "Draft", "Entwürfe", "Brouillons", "Borradores",
+	},
+	AttrFlagged: {
+		"[Gmail]/Starred", "[Google Mail]/Starred", "Starred", "Flagged",
+	},
+	AttrJunk: {
+		"Junk", "[Gmail]/Spam", "[Google Mail]/Spam", "Spam", "Junk E-mail", "Junk Email", "Junk-E-Mail", "Bulk Mail",
+		"Courrier indésirable", "Correo no deseado",
+	},
+	AttrSent: {
+		"Sent", "[Gmail]/Sent Mail", "[Google Mail]/Sent Mail", "Sent Items", "Sent Messages", "Sent Mail",
+		"Gesendete Objekte", "Gesendet", "Éléments envoyés", "Envoyés", "Elementos enviados",
+	},
+	AttrTrash: {
+		"Trash", "[Gmail]/Trash", "[Google Mail]/Trash", "[Gmail]/Bin", "[Google Mail]/Bin", "Deleted Items",
+		"Deleted Messages", "Deleted", "Bin", "Papierkorb", "Gelöschte Elemente", "Corbeille", "Éléments supprimés",
+		"Elementos eliminados",
+	},
+}
+
+// SpecialFolders returns the special use folders by attribute, e.g. AttrSent. The attributes
+// returned by LIST are used when the server supports SPECIAL-USE (RFC 6154), otherwise or for any
+// attribute that isn't found, the folder is found from a table of well known names.
+// Attributes without a folder are not included
+func (d *Dialer) SpecialFolders() (folders map[string]string, err error) {
+	return d.SpecialFoldersContext(context.Background())
+}
+
+// SpecialFoldersContext is SpecialFolders with a context that can cancel the command or set its deadline
+func (d *Dialer) SpecialFoldersContext(ctx context.Context) (folders map[string]string, err error) {
+	var mailboxes []Mailbox
+	if d.has(ctx, "SPECIAL-USE") && d.has(ctx, "LIST-EXTENDED") {
+		mailboxes, err = d.list(ctx, `LIST "" "*" RETURN (SPECIAL-USE)`)
+	} else {
+		// RETURN is LIST-EXTENDED (RFC 5258) syntax, a plain LIST includes the special use attributes anyway
+		mailboxes, err = d.ListFoldersContext(ctx, "", "*")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return specialFolders(mailboxes), nil
+}
+
+// FindSpecialUse returns the name of the special use folder with the attribute, e.g. AttrSent,
+// using the same rules as SpecialFolders. An empty name is returned if there is no such folder
+func (d *Dialer) FindSpecialUse(attr string) (folder string, err error) {
+	return d.FindSpecialUseContext(context.Background(), attr)
+}
+
+// FindSpecialUseContext is FindSpecialUse with a context that can cancel the command or set its deadline
+func (d *Dialer) FindSpecialUseContext(ctx context.Context, attr string) (folder string, err error) {
+	folders, err := d.SpecialFoldersContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	for a, f := range folders {
+		if strings.EqualFold(a, attr) {
+			return f, nil
+		}
+	}
+	return "", nil
+}
+
+// specialFolders finds the special use folders in mailboxes
+func specialFolders(mailboxes []Mailbox) map[string]string {
+	folders := make(map[string]string)
+
+	for _, attr := range SpecialUseAttributes {
+		for _, m := range mailboxes {
+			if m.Has(attr) && m.Selectable() {
+				folders[attr] = m.Name
+				break
+			}
+		}
+	}
+
+	for _, attr := range SpecialUseAttributes {
+		if _, ok := folders[attr]; ok {
+			continue
+		}
+	Names:
+		for _, name := range specialUseNames[attr] {
+			for _, m := range mailboxes {
+				if m.Selectable() && specialUseNameMatches(m, name) {
+					folders[attr] = m.Name
+					break Names
+				}
+			}
+		}
+	}
+
+	return folders
+}
+
+// specialUseNameMatches returns true if the folder has the well known name, either at the
+// top level or below INBOX
+func specialUseNameMatches(m Mailbox, name string) bool {
+	if strings.EqualFold(m.Name, name) {
+		return true
+	}
+	if m.Delimiter != "" && strings.Contains(name, m.Delimiter) {
+		return false
+	}
+	prefix := "INBOX" + m.Delimiter
+	return m.Delimiter != "" && len(m.Name) > len(prefix) &&
+		strings.EqualFold(m.Name[:len(prefix)], prefix) && strings.EqualFold(m.Name[len(prefix):], name)
+}
+
+// CreateSpecialUseFolder creates a folder with the special use attribute, e.g. AttrSent,
+// this requires the server to support CREATE-SPECIAL-USE (RFC 6154)
+func (d *Dialer) CreateSpecialUseFolder(folder string, attr string) (err error) {
+	return d.CreateSpecialUseFolderContext(context.Background(), folder, attr)
+}
+
+// CreateSpecialUseFolderContext is CreateSpecialUseFolder with a context that can cancel the command or set its deadline
+func (d *Dialer) CreateSpecialUseFolderContext(ctx context.Context, folder string, attr string) (err error) {
+	if !d.has(ctx, "CREATE-SPECIAL-USE") {
+		return fmt.Errorf("imap create: server does not support CREATE-SPECIAL-USE")
+	}
+	valid := false
+	for _, a := range SpecialUseAttributes {
+		if strings.EqualFold(a, attr) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return fmt.Errorf("imap create: invalid special use attribute %q", attr)
+	}
+
+	_, err = d.ExecContext(ctx, "CREATE "+d.mailbox(folder)+" (USE ("+attr+"))", false, nil)
+	return
+}
@@ -0,0 +1,163 @@
+package imap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Status items (RFC 3501 6.3.10) which can be requested by Status and ListFoldersWithStatus
+const (
+	StatusMessages      = "MESSAGES"
+	StatusRecent        = "RECENT"
+	StatusUIDNext       = "UIDNEXT"
+	StatusUIDValidity   = "UIDVALIDITY"
+	StatusUnseen        = "UNSEEN"
+	StatusHighestModSeq = "HIGHESTMODSEQ"
+	StatusSize          = "SIZE"
+	StatusDeleted       = "DELETED"
+)
+
+// defaultStatusItems are requested when no items are given
+var defaultStatusItems = []string{StatusMessages, StatusRecent, StatusUIDNext, StatusUIDValidity, StatusUnseen}
+
+// Status returns the status of a folder without selecting it, which is much cheaper than
+// selecting it and searching. If no items are given MESSAGES, RECENT, UIDNEXT, UIDVALIDITY
+// and UNSEEN are requested; HIGHESTMODSEQ requires CONDSTORE, SIZE requires STATUS=SIZE and
+// DELETED requires IMAP4rev2
+func (d *Dialer) Status(folder string, items ...string) (status *MailboxStatus, err error) {
+	return d.StatusContext(context.Background(), folder, items...)
+}
+
+// StatusContext is Status with a context that can cancel the command or set its deadline
+func (d *Dialer) StatusContext(ctx context.Context, folder string, items ...string) (status *MailboxStatus, err error) {
+	if len(items) == 0 {
+		items = defaultStatusItems
+	}
+
+	_, err = d.ExecContext(ctx, "STATUS "+d.mailbox(folder)+" ("+strings.Join(items, " ")+")", false, func(line []byte) (err error) {
+		s, ok, err := d.parseStatusLine(line)
+		if err != nil || !ok {
+			return
+		}
+		status = s
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	if status == nil {
+		return nil, fmt.Errorf("imap status: no status returned for %q", folder)
+	}
+	status.Name = folder
+
+	return status, nil
+}
+
+// ListFoldersWithStatus is ListFolders also returning the status of each folder that can be
+// selected in Mailbox.Status, items are as for Status. When the server supports LIST-STATUS
+// (RFC 5819) everything is returned by a single command, otherwise STATUS is run for each folder
+func (d *Dialer) ListFoldersWithStatus(ref string, pattern string, items ...string) (mailboxes []Mailbox, err error) {
+	return d.ListFoldersWithStatusContext(context.Background(), ref, pattern, items...)
+}
+
+// ListFoldersWithStatusContext is ListFoldersWithStatus with a context that can cancel the command or set its deadline
+func (d *Dialer) ListFoldersWithStatusContext(ctx context.Context, ref string, pattern string, items ...string) (mailboxes []Mailbox, err error) {
+	if len(items) == 0 {
+		items = defaultStatusItems
+	}
+
+	if !d.has(ctx, "LIST-STATUS") {
+		if mailboxes, err = d.ListFoldersContext(ctx, ref, pattern); err != nil {
+			return nil, err
+		}
+		for i, m := range mailboxes {
+			if !m.Selectable() {
+				continue
+			}
+			if mailboxes[i].Status, err = d.StatusContext(ctx, m.Name, items...); err != nil {
+				return nil, err
+			}
+		}
+		return mailboxes, nil
+	}
+
+	mailboxes = make([]Mailbox, 0)
+	statuses := make(map[string]*MailboxStatus)
+	command := "LIST " + d.mailbox(ref) + " " + d.mailbox(pattern) + " RETURN (STATUS (" + strings.Join(items, " ") + "))"
+	_, err = d.ExecContext(ctx, command, false, func(line []byte) (err error) {
+		if m, ok, err := parseListLine(line); err != nil {
+			return err
+		} else if ok {
+			m.Name = d.decodeMailbox(m.Name)
+			mailboxes = append(mailboxes, m)
+			return nil
+		}
+		if s, ok, err := d.parseStatusLine(line); err != nil {
+			return err
+		} else if ok {
+			statuses[s.Name] = s
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, m := range mailboxes {
+		mailboxes[i].Status = statuses[m.Name]
+	}
+	return mailboxes, nil
+}
+
+// parseStatusLine parses an untagged STATUS response, ok is false for other responses
+func (d *Dialer) parseStatusLine(line []byte) (status *MailboxStatus, ok bool, err error) {
+	line = dropNl(line)
+	if !bytes.HasPrefix(line, []byte("* STATUS ")) {
+		return nil, false, nil
+	}
+	invalid := fmt.Errorf("imap: invalid STATUS response %q", line)
+
+	name, rest, err := parseAString(line[len("* STATUS "):])
+	if err != nil {
+		return nil, false, invalid
+	}
+	rest = bytes.TrimSpace(rest)
+	if len(rest) < 2 || rest[0] != '(' || rest[len(rest)-1] != ')' {
+		return nil, false, invalid
+	}
+	fields := strings.Fields(string(rest[1 : len(rest)-1]))
+	if len(fields)%2 != 0 {
+		return nil, false, invalid
+	}
+
+	status = &MailboxStatus{Name: d.decodeMailbox(name)}
+	for i := 0; i < len(fields); i += 2 {
+		n, err := strconv.ParseInt(fields[i+1], 10, 64)
+		if err != nil {
+			return nil, false, invalid
+		}
+		switch strings.ToUpper(fields[i]) {
+		case StatusMessages:
+			status.Messages = int(n)
+		case StatusRecent:
+			status.Recent = int(n)
+		case StatusUIDNext:
+			status.UIDNext = int(n)
+		case StatusUIDValidity:
+			status.UIDValidity = int(n)
+		case StatusUnseen:
+			status.Unseen = int(n)
+		case StatusHighestModSeq:
+			status.HighestModSeq = uint64(n)
+		case StatusSize:
+			status.Size = n
+		case StatusDeleted:
+			status.Deleted = int(n)
+		}
+	}
+
+	return status, true, nil
+}
@@ -0,0 +1,125 @@
+package imap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatusLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want MailboxStatus
+	}{
+		{`* STATUS "INBOX" (MESSAGES 231 UIDNEXT 44292)`, MailboxStatus{Name: "INBOX", Messages: 231, UIDNext: 44292}},
+		{`* STATUS INBOX ()`, MailboxStatus{Name: "INBOX"}},
+		// Items in a different order from the request, in lower case and unknown items
+		{
+			`* STATUS "Sent" (unseen 3 UIDVALIDITY 1 X-GUID 7 RECENT 2 messages 10)`,
+			MailboxStatus{Name: "Sent", Messages: 10, Recent: 2, UIDValidity: 1, Unseen: 3},
+		},
+		{
+			`* STATUS "Archive" (DELETED 4 SIZE 9876543210 HIGHESTMODSEQ 715194045007 UIDVALIDITY 3857529045)`,
+			MailboxStatus{Name: "Archive", UIDValidity: 3857529045, HighestModSeq: 715194045007, Size: 9876543210, Deleted: 4},
+		},
+		// Quoted and literal names, decoded from modified UTF-7
+		{`* STATUS "Customers/Acme \"Ltd\"" (MESSAGES 1)`, MailboxStatus{Name: `Customers/Acme "Ltd"`, Messages: 1}},
+		{"* STATUS {12}\r\nEntw&APw-rfe (MESSAGES 2)", MailboxStatus{Name: "Entwürfe", Messages: 2}},
+		{`* STATUS "Entw&APw-rfe" (MESSAGES 3)`, MailboxStatus{Name: "Entwürfe", Messages: 3}},
+		{`* STATUS "INBOX" (MESSAGES 1) `, MailboxStatus{Name: "INBOX", Messages: 1}},
+	}
+	d := &Dialer{}
+	for _, tt := range tests {
+		s, ok, err := d.parseStatusLine([]byte(tt.line + "\r\n"))
+		require.NoError(t, err, tt.line)
+		require.True(t, ok, tt.line)
+		require.Equal(t, tt.want, *s, tt.line)
+	}
+
+	// Other responses are ignored
+	for _, line := range []string{`* LIST () "/" INBOX`, "* 1 EXISTS", "A1 OK STATUS done"} {
+		_, ok, err := d.parseStatusLine([]byte(line + "\r\n"))
+		require.NoError(t, err, line)
+		require.False(t, ok, line)
+	}
+
+	for _, line := range []string{
+		`* STATUS `,
+		`* STATUS "INBOX"`,
+		`* STATUS "INBOX" MESSAGES 1`,
+		`* STATUS "INBOX" (MESSAGES 1`,
+		`* STATUS "INBOX" (MESSAGES)`,
+		`* STATUS "INBOX" (MESSAGES x)`,
+		`* STATUS "INBOX" (1 MESSAGES)`,
+		`* STATUS "INBOX (MESSAGES 1)`,
+	} {
+		_, _, err := d.parseStatusLine([]byte(line + "\r\n"))
+		require.Error(t, err, line)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	d, server := newPipeDialer(t)
+	commands := make(chan string, 10)
+	go scriptServer(server, map[string][]string{
+		`STATUS "Entw&APw-rfe" (UNSEEN MESSAGES)`:                     {`* STATUS "Entw&APw-rfe" (MESSAGES 5 UNSEEN 2)`, "Done"},
+		`STATUS "Empty" (MESSAGES RECENT UIDNEXT UIDVALIDITY UNSEEN)`: {"Done"},
+	}, commands)
+
+	s, err := d.Status("Entwürfe", StatusUnseen, StatusMessages)
+	require.NoError(t, err)
+	require.Equal(t, `STATUS "Entw&APw-rfe" (UNSEEN MESSAGES)`, <-commands)
+	require.Equal(t, &MailboxStatus{Name: "Entwürfe", Messages: 5, Unseen: 2}, s)
+
+	// A server which doesn't return a status
+	_, err = d.Status("Empty")
+	require.Error(t, err)
+	require.Equal(t, `STATUS "Empty" (MESSAGES RECENT UIDNEXT UIDVALIDITY UNSEEN)`, <-commands)
+}
+
+func TestListFoldersWithStatus(t *testing.T) {
+	d, server := newPipeDialer(t)
+	d.capabilities = []string{"IMAP4rev1", "LIST-EXTENDED", "LIST-STATUS"}
+	commands := make(chan string, 10)
+	go scriptServer(server, map[string][]string{
+		`LIST "" "*" RETURN (STATUS (MESSAGES UNSEEN))`: {
+			// STATUS responses can come before or after their LIST response
+			`* STATUS "Entw&APw-rfe" (UNSEEN 1 MESSAGES 4)`,
+			`* LIST (\HasNoChildren) "/" "Entw&APw-rfe"`,
+			`* LIST (\Noselect \HasChildren) "/" "Customers"`,
+			`* LIST (\HasNoChildren) "/" INBOX`,
+			`* STATUS INBOX (MESSAGES 10 UNSEEN 0)`,
+			"Done",
+		},
+	}, commands)
+
+	mailboxes, err := d.ListFoldersWithStatus("", "*", StatusMessages, StatusUnseen)
+	require.NoError(t, err)
+	require.Equal(t, `LIST "" "*" RETURN (STATUS (MESSAGES UNSEEN))`, <-commands)
+	require.Equal(t, []string{"Entwürfe", "Customers", "INBOX"}, mailboxNames(mailboxes))
+	require.Equal(t, &MailboxStatus{Name: "Entwürfe", Messages: 4, Unseen: 1}, mailboxes[0].Status)
+	require.Nil(t, mailboxes[1].Status)
+	require.Equal(t, &MailboxStatus{Name: "INBOX", Messages: 10}, mailboxes[2].Status)
+}
+
+func TestListFoldersWithStatusFallback(t *testing.T) {
+	d, server := newPipeDialer(t)
+	d.capabilities = []string{"IMAP4rev1"}
+	commands := make(chan string, 10)
+	go scriptServer(server, map[string][]string{
+		`LIST "" "*"`: {
+			`* LIST (\Noselect \HasChildren) "/" "Customers"`,
+			`* LIST (\HasNoChildren) "/" INBOX`,
+			"Done",
+		},
+		`STATUS "INBOX" (MESSAGES)`: {`* STATUS "INBOX" (MESSAGES 10)`, "Done"},
+	}, commands)
+
+	// STATUS is run for each folder which can be selected
+	mailboxes, err := d.ListFoldersWithStatus("", "*", StatusMessages)
+	require.NoError(t, err)
+	require.Equal(t, `LIST "" "*"`, <-commands)
+	require.Equal(t, `STATUS "INBOX" (MESSAGES)`, <-commands)
+	require.Nil(t, mailboxes[0].Status)
+	require.Equal(t, &MailboxStatus{Name: "INBOX", Messages: 10}, mailboxes[1].Status)
+}
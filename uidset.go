@@ -0,0 +1,357 @@
+package imap
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultBatchSize is the number of UIDs or UID ranges sent in one command when Dialer.BatchSize is zero
+const DefaultBatchSize = 1000
+
+// Star is the * of a sequence set, the largest UID or sequence number in the folder, e.g.
+// set.AddRange(100, imap.Star) is 100:*. Set arithmetic treats it as larger than any other number
+const Star = math.MaxInt
+
+// UIDSet is a set of UIDs which is sent to the server compressed into ranges, e.g. 1:500,502,510:900.
+// The zero value is an empty set
+type UIDSet struct {
+	numSet
+}
+
+// SeqSet is a set of message sequence numbers which is sent to the server compressed into ranges,
+// e.g. 1:500,502,510:*. The zero value is an empty set
+type SeqSet struct {
+	numSet
+}
+
+// numSet is the set of numbers behind UIDSet and SeqSet
+type numSet struct {
+	// ranges are sorted and neither overlap nor touch
+	ranges []numRange
+}
+
+// numRange is the numbers from start to stop inclusive, stop is Star for n:*
+type numRange struct {
+	start, stop int
+}
+
+// NewUIDSet returns a set of the UIDs, UIDs of 0 or less are ignored
+func NewUIDSet(uids ...int) UIDSet {
+	s := UIDSet{}
+	s.Add(uids...)
+	return s
+}
+
+// NewSeqSet returns a set of the sequence numbers, numbers of 0 or less are ignored
+func NewSeqSet(nums ...int) SeqSet {
+	s := SeqSet{}
+	s.Add(nums...)
+	return s
+}
+
+// ParseUIDSet parses a set in IMAP sequence set syntax, e.g. 1:500,502,510:*
+func ParseUIDSet(s string) (UIDSet, error) {
+	set, err := parseNumSet(s)
+	return UIDSet{set}, err
+}
+
+// ParseSeqSet parses a set in IMAP sequence set syntax, e.g. 1:500,502,510:*
+func ParseSeqSet(s string) (SeqSet, error) {
+	set, err := parseNumSet(s)
+	return SeqSet{set}, err
+}
+
+func parseNumSet(s string) (set numSet, err error) {
+	if s == "" {
+		return set, fmt.Errorf("imap: empty sequence set")
+	}
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(part, ":")
+		start, err := parseSetNumber(from)
+		if err != nil {
+			return numSet{}, fmt.Errorf("imap: invalid sequence set %q", s)
+		}
+		stop := start
+		if isRange {
+			if stop, err = parseSetNumber(to); err != nil {
+				return numSet{}, fmt.Errorf("imap: invalid sequence set %q", s)
+			}
+		}
+		set.AddRange(start, stop)
+	}
+	return set, nil
+}
+
+// parseSetNumber parses a number or * of a sequence set
+func parseSetNumber(s string) (int, error) {
+	if s == "*" {
+		return Star, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("imap: invalid number %q", s)
+	}
+	return n, nil
+}
+
+// Add adds the numbers to the set, numbers of 0 or less are ignored
+func (s *numSet) Add(nums ...int) {
+	sorted := make([]int, 0, len(nums))
+	for _, n := range nums {
+		if n > 0 {
+			sorted = append(sorted, n)
+		}
+	}
+	sort.Ints(sorted)
+
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] <= sorted[j]+1 {
+			j++
+		}
+		s.AddRange(sorted[i], sorted[j])
+		i = j + 1
+	}
+}
+
+// AddRange adds the numbers from start to stop inclusive to the set, stop can be Star
+func (s *numSet) AddRange(start int, stop int) {
+	if start > stop {
+		start, stop = stop, start
+	}
+	if start < 1 {
+		start = 1
+	}
+	if stop < start {
+		return
+	}
+
+	// Find the first range which isn't entirely before the new one, allowing for touching ranges
+	i := sort.Search(len(s.ranges), func(i int) bool { return s.ranges[i].stop >= start-1 })
+	j := i
+	for j < len(s.ranges) && (stop == Star || s.ranges[j].start <= stop+1) {
+		if s.ranges[j].start < start {
+			start = s.ranges[j].start
+		}
+		if s.ranges[j].stop > stop {
+			stop = s.ranges[j].stop
+		}
+		j++
+	}
+
+	ranges := make([]numRange, 0, len(s.ranges)-(j-i)+1)
+	ranges = append(ranges, s.ranges[:i]...)
+	ranges = append(ranges, numRange{start, stop})
+	s.ranges = append(ranges, s.ranges[j:]...)
+}
+
+// Contains returns true if n is in the set, a range ending in * contains every number from its start
+func (s numSet) Contains(n int) bool {
+	i := sort.Search(len(s.ranges), func(i int) bool { return s.ranges[i].stop >= n })
+	return i < len(s.ranges) && s.ranges[i].start <= n
+}
+
+// Dynamic returns true if the set contains *, so its contents depend on the folder
+func (s numSet) Dynamic() bool {
+	return len(s.ranges) != 0 && s.ranges[len(s.ranges)-1].stop == Star
+}
+
+// Empty returns true if the set has no numbers
+func (s numSet) Empty() bool {
+	return len(s.ranges) == 0
+}
+
+// Len returns how many numbers are in the set, not counting a range ending in *
+func (s numSet) Len() int {
+	n := 0
+	for _, r := range s.ranges {
+		if r.stop != Star {
+			n += r.stop - r.start + 1
+		}
+	}
+	return n
+}
+
+// Each calls f with each number in the set in order until it returns false,
+// a range ending in * is skipped as its end isn't known
+func (s numSet) Each(f func(n int) bool) {
+	for _, r := range s.ranges {
+		if r.stop == Star {
+			return
+		}
+		for n := r.start; n <= r.stop; n++ {
+			if !f(n) {
+				return
+			}
+		}
+	}
+}
+
+// Ints returns the numbers in the set in order, a range ending in * is left out as its end isn't known
+func (s numSet) Ints() []int {
+	nums := make([]int, 0, s.Len())
+	s.Each(func(n int) bool {
+		nums = append(nums, n)
+		return true
+	})
+	return nums
+}
+
+// String returns the set in IMAP sequence set syntax, e.g. 1:500,502,510:*
+func (s numSet) String() string {
+	b := strings.Builder{}
+	for i, r := range s.ranges {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(formatSetNumber(r.start))
+		if r.stop != r.start {
+			b.WriteByte(':')
+			b.WriteString(formatSetNumber(r.stop))
+		}
+	}
+	return b.String()
+}
+
+// formatSetNumber formats a number of a sequence set, which may be *
+func formatSetNumber(n int) string {
+	if n == Star {
+		return "*"
+	}
+	return strconv.Itoa(n)
+}
+
+func (s numSet) union(other numSet) numSet {
+	u := numSet{ranges: append([]numRange(nil), s.ranges...)}
+	for _, r := range other.ranges {
+		u.AddRange(r.start, r.stop)
+	}
+	return u
+}
+
+func (s numSet) intersection(other numSet) numSet {
+	result := numSet{}
+	i, j := 0, 0
+	for i < len(s.ranges) && j < len(other.ranges) {
+		a, b := s.ranges[i], other.ranges[j]
+		start, stop := a.start, a.stop
+		if b.start > start {
+			start = b.start
+		}
+		if b.stop < stop {
+			stop = b.stop
+		}
+		if start <= stop {
+			result.ranges = append(result.ranges, numRange{start, stop})
+		}
+		if a.stop < b.stop {
+			i++
+		} else {
+			j++
+		}
+	}
+	return result
+}
+
+func (s numSet) difference(other numSet) numSet {
+	result := numSet{}
+	j := 0
+	for _, r := range s.ranges {
+		start := r.start
+		covered := false
+		for j < len(other.ranges) && other.ranges[j].stop < start {
+			j++
+		}
+		for k := j; k < len(other.ranges) && other.ranges[k].start <= r.stop; k++ {
+			o := other.ranges[k]
+			if o.start == Star && start != Star {
+				// The number before * isn't known, so * can only be taken away on its own
+				break
+			}
+			if o.start > start {
+				result.ranges = append(result.ranges, numRange{start, o.start - 1})
+			}
+			if o.stop >= r.stop {
+				covered = true
+				break
+			}
+			start = o.stop + 1
+		}
+		if !covered {
+			result.ranges = append(result.ranges, numRange{start, r.stop})
+		}
+	}
+	return result
+}
+
+// resolve replaces * with max, the largest number in the folder
+func (s numSet) resolve(max int) numSet {
+	result := numSet{}
+	for _, r := range s.ranges {
+		switch {
+		case r.start == Star:
+			result.AddRange(max, max)
+		case r.stop == Star:
+			result.AddRange(r.start, max)
+		default:
+			result.AddRange(r.start, r.stop)
+		}
+	}
+	return result
+}
+
+// Union returns the UIDs in either set
+func (s UIDSet) Union(other UIDSet) UIDSet { return UIDSet{s.union(other.numSet)} }
+
+// Intersection returns the UIDs in both sets
+func (s UIDSet) Intersection(other UIDSet) UIDSet { return UIDSet{s.intersection(other.numSet)} }
+
+// Difference returns the UIDs in s that aren't in other. Taking * alone from a range ending in *
+// leaves the range unchanged as the UID before * isn't known
+func (s UIDSet) Difference(other UIDSet) UIDSet { return UIDSet{s.difference(other.numSet)} }
+
+// Resolve returns the set with * replaced by max, e.g. the UIDNext of the folder less one
+func (s UIDSet) Resolve(max int) UIDSet { return UIDSet{s.resolve(max)} }
+
+// Union returns the sequence numbers in either set
+func (s SeqSet) Union(other SeqSet) SeqSet { return SeqSet{s.union(other.numSet)} }
+
+// Intersection returns the sequence numbers in both sets
+func (s SeqSet) Intersection(other SeqSet) SeqSet { return SeqSet{s.intersection(other.numSet)} }
+
+// Difference returns the sequence numbers in s that aren't in other. Taking * alone from a range
+// ending in * leaves the range unchanged as the number before * isn't known
+func (s SeqSet) Difference(other SeqSet) SeqSet { return SeqSet{s.difference(other.numSet)} }
+
+// Resolve returns the set with * replaced by max, e.g. the number of messages in the folder
+func (s SeqSet) Resolve(max int) SeqSet { return SeqSet{s.resolve(max)} }
+
+// batches splits the set into sets of at most size numbers or ranges
+func (s numSet) batches(size int) []numSet {
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	batches := make([]numSet, 0, len(s.ranges)/size+1)
+	for i := 0; i < len(s.ranges); i += size {
+		end := i + size
+		if end > len(s.ranges) {
+			end = len(s.ranges)
+		}
+		batches = append(batches, numSet{ranges: s.ranges[i:end]})
+	}
+	return batches
+}
+
+// uidBatches returns the UIDs as sets of at most BatchSize UIDs or UID ranges, each of
+// which is sent in its own command so long lists don't exceed the server's line length limit
+func (d *Dialer) uidBatches(uids UIDSet) []string {
+	batches := uids.batches(d.BatchSize)
+	sets := make([]string, len(batches))
+	for i, b := range batches {
+		sets[i] = b.String()
+	}
+	return sets
+}
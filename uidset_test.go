@@ -0,0 +1,195 @@
+package imap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func mustParseUIDSet(t *testing.T, s string) UIDSet {
+	t.Helper()
+	if s == "" {
+		return UIDSet{}
+	}
+	set, err := ParseUIDSet(s)
+	require.NoError(t, err, s)
+	return set
+}
+
+func TestParseUIDSet(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"1", "1"},
+		{"1:5", "1:5"},
+		{"5:1", "1:5"},
+		{"1,2,3", "1:3"},
+		{"3,1,2", "1:3"},
+		{"1:3,4:6", "1:6"},
+		{"1:3,5:6", "1:3,5:6"},
+		{"1:5,3:8", "1:8"},
+		{"2:4,1:10", "1:10"},
+		{"1:500,502,510:900", "1:500,502,510:900"},
+		{"*", "*"},
+		{"*:*", "*"},
+		{"500:*", "500:*"},
+		{"*:500", "500:*"},
+		{"1,500:*", "1,500:*"},
+		{"600,500:*", "500:*"},
+		{"499,500:*", "499:*"},
+		{"1:10,5:*", "1:*"},
+	}
+	for _, tt := range tests {
+		set := mustParseUIDSet(t, tt.in)
+		require.Equal(t, tt.out, set.String(), tt.in)
+
+		// The formatted set parses back to itself
+		require.Equal(t, set, mustParseUIDSet(t, set.String()), tt.in)
+	}
+
+	for _, in := range []string{"", ",", "1,", "0", "-1", "1:0", "a", "1:b", "1::2", "1:2:3", " 1"} {
+		_, err := ParseUIDSet(in)
+		require.Error(t, err, in)
+	}
+}
+
+func TestUIDSetAdd(t *testing.T) {
+	require.Equal(t, "", NewUIDSet().String())
+	require.Equal(t, "", NewUIDSet(0, -5).String())
+	require.Equal(t, "1:3,7,9:10", NewUIDSet(10, 3, 1, 9, 2, 7, 3).String())
+
+	set := NewUIDSet(1, 5)
+	set.AddRange(2, 4)
+	require.Equal(t, "1:5", set.String())
+	set.AddRange(7, 8)
+	set.AddRange(10, Star)
+	require.Equal(t, "1:5,7:8,10:*", set.String())
+	set.AddRange(9, 9)
+	require.Equal(t, "1:5,7:*", set.String())
+	set.AddRange(6, 6)
+	require.Equal(t, "1:*", set.String())
+}
+
+func TestUIDSetMembership(t *testing.T) {
+	set := mustParseUIDSet(t, "2:4,8,10:*")
+	for n, want := range map[int]bool{1: false, 2: true, 4: true, 5: false, 8: true, 9: false, 10: true, 1000000: true} {
+		require.Equal(t, want, set.Contains(n), n)
+	}
+	require.True(t, set.Dynamic())
+	require.False(t, set.Empty())
+	require.Equal(t, 4, set.Len())
+	require.Equal(t, []int{2, 3, 4, 8}, set.Ints())
+
+	each := make([]int, 0)
+	set.Each(func(n int) bool {
+		each = append(each, n)
+		return n < 3
+	})
+	require.Equal(t, []int{2, 3}, each)
+
+	require.False(t, mustParseUIDSet(t, "1:5").Dynamic())
+	require.True(t, UIDSet{}.Empty())
+	require.Equal(t, []int{}, UIDSet{}.Ints())
+}
+
+func TestUIDSetOperations(t *testing.T) {
+	tests := []struct {
+		a, b                              string
+		union, intersection, aDiff, bDiff string
+	}{
+		{"", "", "", "", "", ""},
+		{"1:5", "", "1:5", "", "1:5", ""},
+		{"1:5", "1:5", "1:5", "1:5", "", ""},
+		// Touching ranges
+		{"1:5", "6:10", "1:10", "", "1:5", "6:10"},
+		{"1:5", "5:10", "1:10", "5", "1:4", "6:10"},
+		// Overlapping and contained ranges
+		{"1:5", "3:8", "1:8", "3:5", "1:2", "6:8"},
+		{"1:10", "3:4", "1:10", "3:4", "1:2,5:10", ""},
+		{"1:10", "1,10", "1:10", "1,10", "2:9", ""},
+		{"1:3,7:9", "2:8", "1:9", "2:3,7:8", "1,9", "4:6"},
+		{"1,3,5", "2,4", "1:5", "", "1,3,5", "2,4"},
+		// n:* on either side
+		{"1:10", "5:*", "1:*", "5:10", "1:4", "11:*"},
+		{"1:10", "11:*", "1:*", "", "1:10", "11:*"},
+		{"1:10", "20:*", "1:10,20:*", "", "1:10", "20:*"},
+		{"5:*", "10:*", "5:*", "10:*", "5:9", ""},
+		{"5:*", "5:*", "5:*", "5:*", "", ""},
+		{"5:*", "1:3,8", "1:3,5:*", "8", "5:7,9:*", "1:3"},
+		{"1:*", "*", "1:*", "*", "1:*", ""},
+		{"*", "1:10", "1:10,*", "", "*", "1:10"},
+	}
+	for _, tt := range tests {
+		a, b := mustParseUIDSet(t, tt.a), mustParseUIDSet(t, tt.b)
+		name := tt.a + " " + tt.b
+		require.Equal(t, tt.union, a.Union(b).String(), "union "+name)
+		require.Equal(t, tt.union, b.Union(a).String(), "union "+name)
+		require.Equal(t, tt.intersection, a.Intersection(b).String(), "intersection "+name)
+		require.Equal(t, tt.intersection, b.Intersection(a).String(), "intersection "+name)
+		require.Equal(t, tt.aDiff, a.Difference(b).String(), "difference "+name)
+		require.Equal(t, tt.bDiff, b.Difference(a).String(), "difference "+name)
+	}
+
+	// The operations don't change their sets
+	a, b := mustParseUIDSet(t, "1:5"), mustParseUIDSet(t, "6:10")
+	a.Union(b)
+	require.Equal(t, "1:5", a.String())
+}
+
+func TestUIDSetResolve(t *testing.T) {
+	tests := []struct {
+		in       string
+		max      int
+		resolved string
+	}{
+		{"1:5", 10, "1:5"},
+		{"500:*", 1000, "500:1000"},
+		{"500:*", 500, "500"},
+		{"500:*", 100, "100:500"},
+		{"*", 42, "42"},
+		{"1:3,*", 4, "1:4"},
+		{"1:10,20:*", 15, "1:10,15:20"},
+	}
+	for _, tt := range tests {
+		resolved := mustParseUIDSet(t, tt.in).Resolve(tt.max)
+		require.Equal(t, tt.resolved, resolved.String(), tt.in)
+		require.False(t, resolved.Dynamic(), tt.in)
+	}
+
+	seq, err := ParseSeqSet("3:*")
+	require.NoError(t, err)
+	require.Equal(t, "3:7", seq.Resolve(7).String())
+	require.Equal(t, "1:2", seq.Difference(NewSeqSet(3, 4)).Union(NewSeqSet(1, 2)).Intersection(NewSeqSet(1, 2, 3)).String())
+}
+
+func TestUIDBatches(t *testing.T) {
+	set := NewUIDSet(1, 2, 3, 5, 7, 9, 11)
+	set.AddRange(20, Star)
+
+	tests := []struct {
+		size    int
+		batches []string
+	}{
+		{0, []string{"1:3,5,7,9,11,20:*"}},
+		{1, []string{"1:3", "5", "7", "9", "11", "20:*"}},
+		{2, []string{"1:3,5", "7,9", "11,20:*"}},
+		{4, []string{"1:3,5,7,9", "11,20:*"}},
+		{6, []string{"1:3,5,7,9,11,20:*"}},
+		{100, []string{"1:3,5,7,9,11,20:*"}},
+	}
+	for _, tt := range tests {
+		d := &Dialer{BatchSize: tt.size}
+		require.Equal(t, tt.batches, d.uidBatches(set), tt.size)
+	}
+
+	require.Empty(t, (&Dialer{}).uidBatches(UIDSet{}))
+
+	// DefaultBatchSize is used when BatchSize is zero
+	large := UIDSet{}
+	for uid := 1; uid <= DefaultBatchSize*2+1; uid++ {
+		large.Add(uid * 2)
+	}
+	batches := (&Dialer{}).uidBatches(large)
+	require.Len(t, batches, 3)
+	require.Equal(t, "4002", batches[2])
+}
@@ -0,0 +1,143 @@
+package imap
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// utf7Encoding is the modified base64 used by modified UTF-7, which uses , instead of /
+var utf7Encoding = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+,").WithPadding(base64.NoPadding)
+
+// EncodeMailboxName encodes a folder name into the modified UTF-7 used by IMAP (RFC 3501 5.1.3),
+// e.g. "Entwürfe" is encoded as "Entw&APw-rfe"
+func EncodeMailboxName(name string) string {
+	s := strings.Builder{}
+	var run []rune
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+		b := make([]byte, 0, len(run)*2)
+		for _, r := range utf16.Encode(run) {
+			b = append(b, byte(r>>8), byte(r))
+		}
+		s.WriteByte('&')
+		s.WriteString(utf7Encoding.EncodeToString(b))
+		s.WriteByte('-')
+		run = run[:0]
+	}
+
+	for _, r := range name {
+		if r >= 0x20 && r <= 0x7e {
+			flush()
+			if r == '&' {
+				s.WriteString("&-")
+			} else {
+				s.WriteRune(r)
+			}
+		} else {
+			run = append(run, r)
+		}
+	}
+	flush()
+
+	return s.String()
+}
+
+// DecodeMailboxName decodes a folder name from the modified UTF-7 used by IMAP (RFC 3501 5.1.3),
+// e.g. "Entw&APw-rfe" is decoded as "Entwürfe"
+func DecodeMailboxName(name string) (string, error) {
+	s := strings.Builder{}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < 0x20 || c > 0x7e {
+			return "", fmt.Errorf("imap: invalid character %q in modified UTF-7 name %q", c, name)
+		}
+		if c != '&' {
+			s.WriteByte(c)
+			continue
+		}
+
+		end := strings.IndexByte(name[i+1:], '-')
+		if end == -1 {
+			return "", fmt.Errorf("imap: unterminated shift sequence in modified UTF-7 name %q", name)
+		}
+		encoded := name[i+1 : i+1+end]
+		i += end + 1
+
+		if encoded == "" {
+			s.WriteByte('&')
+			continue
+		}
+
+		b, err := utf7Encoding.DecodeString(encoded)
+		if err != nil || len(b)%2 != 0 {
+			return "", fmt.Errorf("imap: invalid shift sequence in modified UTF-7 name %q", name)
+		}
+		units := make([]uint16, len(b)/2)
+		for j := range units {
+			units[j] = uint16(b[j*2])<<8 | uint16(b[j*2+1])
+		}
+		for _, r := range utf16.Decode(units) {
+			if r == utf8.RuneError {
+				return "", fmt.Errorf("imap: invalid UTF-16 in modified UTF-7 name %q", name)
+			}
+			s.WriteRune(r)
+		}
+	}
+
+	return s.String(), nil
+}
+
+// mailbox returns a folder name ready to be sent in a command, quoted and encoded
+// as modified UTF-7 unless RawMailboxNames is set or UTF8=ACCEPT is enabled
+func (d *Dialer) mailbox(name string) string {
+	if d.RawMailboxNames || d.utf8Accept {
+		return quote(name)
+	}
+	return quote(EncodeMailboxName(name))
+}
+
+// decodeMailbox decodes a folder name received from the server, unless RawMailboxNames is set
+// or UTF8=ACCEPT is enabled. Names which are not valid modified UTF-7 are returned unchanged
+func (d *Dialer) decodeMailbox(name string) string {
+	if d.RawMailboxNames || d.utf8Accept {
+		return name
+	}
+	decoded, err := DecodeMailboxName(name)
+	if err != nil {
+		d.log(d.Folder, fmt.Sprintf("folder name could not be decoded, using it unchanged: %s", err))
+		return name
+	}
+	return decoded
+}
+
+// Enable enables server extensions with the ENABLE command (RFC 5161), returning those the server
+// enabled. When UTF8=ACCEPT (RFC 6855) is enabled folder names are sent and received as UTF-8
+func (d *Dialer) Enable(capabilities ...string) (enabled []string, err error) {
+	return d.EnableContext(context.Background(), capabilities...)
+}
+
+// EnableContext is Enable with a context that can cancel the command or set its deadline
+func (d *Dialer) EnableContext(ctx context.Context, capabilities ...string) (enabled []string, err error) {
+	enabled = make([]string, 0)
+	_, err = d.ExecContext(ctx, "ENABLE "+strings.Join(capabilities, " "), false, func(line []byte) (err error) {
+		fields := strings.Fields(string(line))
+		if len(fields) >= 2 && fields[0] == "*" && strings.EqualFold(fields[1], "ENABLED") {
+			enabled = append(enabled, fields[2:]...)
+		}
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if hasCapability(enabled, "UTF8=ACCEPT") {
+		d.utf8Accept = true
+	}
+	return enabled, nil
+}
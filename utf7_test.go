@@ -0,0 +1,56 @@
+package imap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMailboxName(t *testing.T) {
+	tests := []struct {
+		name, encoded string
+	}{
+		{"", ""},
+		{"INBOX", "INBOX"},
+		{"Entwürfe", "Entw&APw-rfe"},
+		{"~peter/mail/台北/日本語", "~peter/mail/&U,BTFw-/&ZeVnLIqe-"},
+		{"Tom & Jerry", "Tom &- Jerry"},
+		{"&&", "&-&-"},
+		{"Éléments envoyés", "&AMk-l&AOk-ments envoy&AOk-s"},
+		{"Приложения", "&BB8EQAQ4BDsEPgQ2BDUEPQQ4BE8-"},
+		{"😀", "&2D3eAA-"},
+		{"a😀b", "a&2D3eAA-b"},
+		{"Tab\there", "Tab&AAk-here"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.encoded, EncodeMailboxName(tt.name), tt.name)
+		decoded, err := DecodeMailboxName(tt.encoded)
+		require.NoError(t, err, tt.encoded)
+		require.Equal(t, tt.name, decoded, tt.encoded)
+	}
+
+	for _, encoded := range []string{
+		"&",         // unterminated
+		"a&AOk",     // unterminated
+		"&AO-",      // not a whole UTF-16 code unit
+		"&2D0-",     // unpaired surrogate
+		"&AOk/-",    // / isn't in the modified base64 alphabet
+		"Entwürfe",  // 8 bit characters must be encoded
+		"tab\there", // as must control characters
+	} {
+		_, err := DecodeMailboxName(encoded)
+		require.Error(t, err, encoded)
+	}
+}
+
+func TestDialerMailboxName(t *testing.T) {
+	d := &Dialer{}
+	require.Equal(t, `"Entw&APw-rfe"`, d.mailbox("Entwürfe"))
+	require.Equal(t, "Entwürfe", d.decodeMailbox("Entw&APw-rfe"))
+	// Names which can't be decoded are left unchanged
+	require.Equal(t, "a&b", d.decodeMailbox("a&b"))
+
+	d.RawMailboxNames = true
+	require.Equal(t, `"Entw&APw-rfe"`, d.mailbox("Entw&APw-rfe"))
+	require.Equal(t, "Entw&APw-rfe", d.decodeMailbox("Entw&APw-rfe"))
+}